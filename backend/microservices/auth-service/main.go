@@ -4,8 +4,23 @@ import (
 	"auth-service/src/config"
 	auth "auth-service/src/controllers"
 	generated "auth-service/src/db/generated"
+	"auth-service/src/events"
+	"auth-service/src/mailer"
+	"auth-service/src/middleware"
+	"auth-service/src/password"
+	"auth-service/src/ratelimit"
+	"auth-service/src/rbac"
 	"auth-service/src/routes"
+	"auth-service/src/security"
+	jwt "auth-service/src/utils"
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,19 +44,84 @@ func init() {
 }
 
 func main() {
-	gin.SetMode(gin.DebugMode)
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		createAdmin(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	log.Printf("Starting in %s mode", cfg.Env)
+
+	gin.SetMode(cfg.GinMode)
 
-	dbPool, err := config.InitDB()
-	auth.InitGoogleOAuth()
+	dbPool, err := config.InitDB(cfg.DB)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer dbPool.Close()
+	if err := rbac.Seed(context.Background(), dbPool); err != nil {
+		log.Fatalf("Failed to seed roles and permissions: %v", err)
+	}
+	middleware.InitPermissions(generated.New(dbPool))
+
+	auth.InitGoogleOAuth(cfg.Google)
+	if err := auth.InitWebAuthn(cfg.WebAuthn); err != nil {
+		log.Fatalf("Failed to initialize WebAuthn: %v", err)
+	}
+
+	if err := jwt.InitKeys(cfg.JWT); err != nil {
+		log.Fatalf("Failed to initialize signing keys: %v", err)
+	}
+	security.InitTokenHashing(cfg.Security.TokenHashKey)
+	if err := security.InitSecretEncryption(cfg.Security.EncryptionKey); err != nil {
+		log.Fatalf("Failed to initialize secret encryption: %v", err)
+	}
+
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
 
-	queries := generated.New(dbPool)
-	authController := auth.NewAuthController(queries)
+	passwords, err := password.NewPolicy(cfg.PasswordPolicy)
+	if err != nil {
+		log.Fatalf("Failed to initialize password policy: %v", err)
+	}
+
+	hasher, err := password.NewHasher(cfg.PasswordHash)
+	if err != nil {
+		log.Fatalf("Failed to initialize password hashing: %v", err)
+	}
+
+	authController := auth.NewAuthController(dbPool, cfg, mail, passwords, hasher)
+
+	if n, err := authController.HashLegacyRefreshTokens(context.Background()); err != nil {
+		log.Fatalf("Failed to hash legacy refresh tokens: %v", err)
+	} else if n > 0 {
+		log.Printf("Hashed %d legacy refresh token(s)", n)
+	}
+
+	publisher, err := events.New(cfg.Events)
+	if err != nil {
+		log.Fatalf("Failed to initialize event publisher: %v", err)
+	}
+	go authController.RunAccountMaintenance(context.Background(), publisher, time.Minute)
+
+	limiter, err := ratelimit.New(cfg.RateLimit)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
 
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Failed to set trusted proxies: %v", err)
+	}
 
 	// ========================================================
 
@@ -58,10 +138,100 @@ func main() {
 		c.JSON(200, gin.H{"status": "Auth service is healthyyyyyyy"})
 	})
 
-	routes.RegisterAuthRoutes(router, authController)
+	routes.RegisterAuthRoutes(router, authController, cfg, limiter)
 
-	log.Println("Starting auth service :8001")
-	if err := router.Run(":8001"); err != nil {
+	log.Printf("Starting auth service %s", cfg.ListenAddr)
+	if err := router.Run(cfg.ListenAddr); err != nil {
 		log.Fatalf("Failed to start server: %v", err.Error())
 	}
 }
+
+// rotateKeys writes the next signing key into the key directory:
+//
+//	auth-service rotate-keys -dir /etc/auth/keys -publish-ahead 1h
+//
+// The new key is served in the JWKS straight away and only starts signing
+// once publish-ahead has passed, giving verifiers time to refresh their cache.
+func rotateKeys(args []string) {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	dir := fs.String("dir", os.Getenv("JWT_KEYS_DIR"), "signing key directory")
+	publishAhead := fs.Duration("publish-ahead", time.Hour, "how long the new key is published before it activates")
+	fs.Parse(args)
+
+	if *dir == "" {
+		log.Fatal("rotate-keys: -dir or JWT_KEYS_DIR is required")
+	}
+
+	key, err := jwt.RotateKeyDir(*dir, *publishAhead, jwt.KeyRetention)
+	if err != nil {
+		log.Fatalf("rotate-keys: %v", err)
+	}
+	log.Printf("New signing key %s published, active from %s", key.ID, key.ActivatesAt.Format(time.RFC3339))
+}
+
+// createAdmin gives an account the admin role, creating it first if needed:
+//
+//	echo "$ADMIN_PASSWORD" | auth-service create-admin -email admin@example.com
+//
+// The password is read from the first line of stdin, and only when the
+// account does not exist yet; it must pass the password policy. The
+// configuration is loaded as for the server, from -config or CONFIG_FILE and
+// the environment.
+func createAdmin(args []string) {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := fs.String("email", "", "email address of the admin account")
+	configFile := fs.String("config", "", "path to a YAML config file")
+	fs.Parse(args)
+
+	if *email == "" {
+		log.Fatal("create-admin: -email is required")
+	}
+
+	var loadArgs []string
+	if *configFile != "" {
+		loadArgs = []string{"-config", *configFile}
+	}
+	cfg, err := config.Load(loadArgs)
+	if err != nil {
+		log.Fatalf("create-admin: %v", err)
+	}
+	policy, err := password.NewPolicy(cfg.PasswordPolicy)
+	if err != nil {
+		log.Fatalf("create-admin: %v", err)
+	}
+	hasher, err := password.NewHasher(cfg.PasswordHash)
+	if err != nil {
+		log.Fatalf("create-admin: %v", err)
+	}
+
+	dbPool, err := config.InitDB(cfg.DB)
+	if err != nil {
+		log.Fatalf("create-admin: %v", err)
+	}
+	defer dbPool.Close()
+
+	ctx := context.Background()
+	if err := rbac.Seed(ctx, dbPool); err != nil {
+		log.Fatalf("create-admin: %v", err)
+	}
+
+	created, err := rbac.CreateAdmin(ctx, dbPool, *email, func() (string, error) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("no password on stdin for the new account: %v", err)
+		}
+		plaintext := strings.TrimRight(line, "\r\n")
+		if violations := policy.Check(plaintext, *email); len(violations) > 0 {
+			return "", fmt.Errorf("password rejected: %s", violations[0].Message)
+		}
+		return hasher.Hash(plaintext)
+	})
+	if err != nil {
+		log.Fatalf("create-admin: %v", err)
+	}
+	if created {
+		log.Printf("Created admin account %s", *email)
+	} else {
+		log.Printf("Granted the admin role to %s", *email)
+	}
+}
@@ -0,0 +1,871 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+
+	"auth-service/src/security"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// devJWTSecret is the HS256 secret older builds fell back to
+	devJWTSecret = "dev-secret-change-me-in-production"
+)
+
+// What accounts with an unverified email address may do
+const (
+	UnverifiedAllow    = "allow"    // log in normally
+	UnverifiedRestrict = "restrict" // log in with tokens only the auth service accepts
+	UnverifiedDeny     = "deny"     // no login until the address is verified
+)
+
+// What happens to an account once its deletion grace period is over
+const (
+	DeletionModeDelete    = "delete"    // remove the user row and everything hanging off it
+	DeletionModeAnonymize = "anonymize" // keep the row with personal data blanked out
+)
+
+// Config is the complete auth-service configuration.
+//
+// Values are layered: built-in defaults, then the YAML file given by -config
+// (or CONFIG_FILE), then environment variables, then command-line flags.
+type Config struct {
+	Env        string `yaml:"env"` // "development" or "production"
+	ListenAddr string `yaml:"listen_addr"`
+	GinMode    string `yaml:"gin_mode"` // defaults to debug in development, release in production
+
+	// TrustedProxies are the addresses or CIDR ranges of the load balancers in
+	// front of the service. Only they may set X-Forwarded-For, which decides
+	// the client IP for rate limits, lockouts and the audit log; empty trusts
+	// no one and uses the connection's address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// FrontendURL is where the browser lands after an OAuth login
+	FrontendURL string `yaml:"frontend_url"`
+
+	DB       DBConfig       `yaml:"db"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Cookie   CookieConfig   `yaml:"cookie"`
+	Google   GoogleConfig   `yaml:"google"`
+	Security SecurityConfig `yaml:"security"`
+	MFA      MFAConfig      `yaml:"mfa"`
+	WebAuthn WebAuthnConfig `yaml:"webauthn"`
+	Mail     MailConfig     `yaml:"mail"`
+
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	PasswordReset     PasswordResetConfig     `yaml:"password_reset"`
+	PasswordPolicy    PasswordPolicyConfig    `yaml:"password_policy"`
+	PasswordHash      PasswordHashConfig      `yaml:"password_hash"`
+	Lockout           LockoutConfig           `yaml:"lockout"`
+	RateLimit         RateLimitConfig         `yaml:"rate_limit"`
+	AccountDeletion   AccountDeletionConfig   `yaml:"account_deletion"`
+	Events            EventsConfig            `yaml:"events"`
+}
+
+type DBConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	SSLMode  string `yaml:"sslmode"`
+
+	MaxConns          int32         `yaml:"max_conns"`
+	MinConns          int32         `yaml:"min_conns"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period"`
+}
+
+// DSN builds the Postgres connection string
+func (db DBConfig) DSN() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		db.User, db.Password, db.Host, db.Port, db.Name, db.SSLMode,
+	)
+}
+
+type JWTConfig struct {
+	// KeysDir holds the RS256 signing keys; empty means an ephemeral dev key
+	KeysDir string `yaml:"keys_dir"`
+
+	// LegacySecret verifies HS256 tokens issued before the switch to RS256
+	LegacySecret string `yaml:"legacy_secret"`
+
+	// LegacyCutover is when RS256 signing went live. Nothing signs with the
+	// legacy secret after it, so HS256 tokens issued later are forgeries.
+	LegacyCutover time.Time `yaml:"legacy_cutover"`
+
+	AccessAudiences []string `yaml:"access_audiences"`
+
+	// LegacyClaimsUntil ends the window for tokens that use user_id instead of
+	// sub. Set it to the cutover plus the refresh token lifetime; it is
+	// required while legacy_secret is set.
+	LegacyClaimsUntil time.Time `yaml:"legacy_claims_until"`
+
+	// MaxAuthzClaimBytes caps the roles and scope claims of an access token,
+	// which travel in every request header and cookie. What does not fit is
+	// left out, roles before scopes; introspection still reports the full
+	// set of roles.
+	MaxAuthzClaimBytes int32 `yaml:"max_authz_claim_bytes"`
+}
+
+// MinAuthzClaimBytes is the smallest max_authz_claim_bytes accepted; less
+// would leave out the scopes other services authorize on.
+const MinAuthzClaimBytes = 256
+
+type CookieConfig struct {
+	Domain   string `yaml:"domain"`
+	Secure   bool   `yaml:"secure"`
+	SameSite string `yaml:"same_site"` // "strict", "lax" or "none"
+}
+
+// SameSiteMode maps the configured value onto net/http
+func (c CookieConfig) SameSiteMode() http.SameSite {
+	switch strings.ToLower(c.SameSite) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+type SecurityConfig struct {
+	TokenHashKey        string `yaml:"token_hash_key"`
+	IntrospectionSecret string `yaml:"introspection_secret"`
+
+	// EncryptionKey is base64 of 32 bytes and encrypts stored MFA secrets
+	EncryptionKey string `yaml:"encryption_key"`
+}
+
+type MFAConfig struct {
+	// Issuer is the account label authenticator apps show next to the code
+	Issuer string `yaml:"issuer"`
+}
+
+type WebAuthnConfig struct {
+	// RPID is the relying party ID passkeys are scoped to, usually the site's
+	// registrable domain. Changing it orphans every registered passkey.
+	RPID          string   `yaml:"rp_id"`
+	RPDisplayName string   `yaml:"rp_display_name"`
+	RPOrigins     []string `yaml:"rp_origins"` // frontend origins allowed to run ceremonies
+}
+
+type MailConfig struct {
+	Driver string     `yaml:"driver"` // "log" or "smtp"
+	From   string     `yaml:"from"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"` // empty disables authentication
+	Password string `yaml:"password"`
+}
+
+type EmailVerificationConfig struct {
+	// Policy is what unverified accounts may do: "allow", "restrict" or "deny"
+	Policy string `yaml:"policy"`
+
+	// URL is the public address of GET /verify-email; links append ?token=
+	URL string `yaml:"url"`
+
+	TokenTTL       time.Duration `yaml:"token_ttl"`
+	ResendCooldown time.Duration `yaml:"resend_cooldown"`
+}
+
+type PasswordResetConfig struct {
+	// URL is the frontend page that asks for the new password; links append ?token=
+	URL      string        `yaml:"url"`
+	TokenTTL time.Duration `yaml:"token_ttl"`
+
+	// ResendCooldown is the minimum time between two reset emails to the same account
+	ResendCooldown time.Duration `yaml:"resend_cooldown"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength int32 `yaml:"min_length"`
+	MaxLength int32 `yaml:"max_length"` // in characters; also bounds the cost of the strength estimate
+
+	// MinStrength is the lowest zxcvbn score accepted, from 0 (anything) to 4
+	MinStrength int32 `yaml:"min_strength"`
+
+	// BannedWords may not appear anywhere in a password, ignoring case and
+	// common letter-for-digit swaps. BannedWordsFile adds one word per line.
+	BannedWords     []string `yaml:"banned_words"`
+	BannedWordsFile string   `yaml:"banned_words_file"`
+
+	// BreachedPasswords is a Have I Been Pwned SHA-1 corpus: either a
+	// directory of range files named by their 5-character hash prefix, or a
+	// single file of HASH:COUNT lines sorted by hash. Empty disables the check.
+	BreachedPasswords string `yaml:"breached_passwords"`
+}
+
+// PasswordHashConfig picks how new passwords are hashed. Stored hashes made
+// with another algorithm or other parameters are upgraded at the next login.
+type PasswordHashConfig struct {
+	Algorithm  string       `yaml:"algorithm"` // "argon2id" or "bcrypt"
+	Argon2     Argon2Config `yaml:"argon2"`
+	BcryptCost int32        `yaml:"bcrypt_cost"`
+}
+
+type Argon2Config struct {
+	Memory      int32 `yaml:"memory"` // KiB
+	Iterations  int32 `yaml:"iterations"`
+	Parallelism int32 `yaml:"parallelism"`
+	SaltLength  int32 `yaml:"salt_length"` // bytes
+	KeyLength   int32 `yaml:"key_length"`  // bytes
+}
+
+// LockoutConfig throttles password guessing. Failures are counted per email
+// address, whether or not it is registered, and per client IP.
+type LockoutConfig struct {
+	Account LockoutLimits `yaml:"account"`
+	IP      LockoutLimits `yaml:"ip"`
+
+	// UnlockURL is the public address of GET /login/unlock; the link mailed
+	// to a locked-out user appends ?token=
+	UnlockURL      string        `yaml:"unlock_url"`
+	UnlockTokenTTL time.Duration `yaml:"unlock_token_ttl"`
+}
+
+type LockoutLimits struct {
+	// FreeAttempts failures go unpunished. Each one after that blocks the
+	// next attempt for BaseDelay, doubling up to MaxDelay.
+	FreeAttempts int32         `yaml:"free_attempts"`
+	BaseDelay    time.Duration `yaml:"base_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+
+	// Threshold failures lock out further attempts for LockDuration
+	Threshold    int32         `yaml:"threshold"`
+	LockDuration time.Duration `yaml:"lock_duration"`
+
+	// Window is how long after the last failure the count starts over
+	Window time.Duration `yaml:"window"`
+}
+
+// How a rate-limit rule groups requests into buckets
+const (
+	RateLimitByIP    = "ip"    // one bucket per client address
+	RateLimitByUser  = "user"  // one per authenticated user, falling back to the address
+	RateLimitByRoute = "route" // one shared by every caller
+)
+
+type RateLimitConfig struct {
+	Enabled bool        `yaml:"enabled"`
+	Backend string      `yaml:"backend"` // "memory" (per replica) or "redis" (shared)
+	Redis   RedisConfig `yaml:"redis"`
+
+	// Rules are referenced by name from the routes; a route whose rule is
+	// missing here is not limited. Rules in a config file replace the
+	// built-in set as a whole.
+	Rules map[string]RateLimitRule `yaml:"rules"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int32  `yaml:"db"`
+}
+
+// RateLimitRule is a token bucket holding Requests tokens that refills
+// completely over Period
+type RateLimitRule struct {
+	Requests int32         `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Key      string        `yaml:"key"` // "ip", "user" or "route"
+}
+
+type AccountDeletionConfig struct {
+	// GracePeriod is how long a deletion request can still be cancelled by logging in
+	GracePeriod time.Duration `yaml:"grace_period"`
+	Mode        string        `yaml:"mode"` // "delete" or "anonymize"
+}
+
+type EventsConfig struct {
+	Driver string `yaml:"driver"` // "log" or "webhook"
+
+	// WebhookURLs each receive every event as a JSON POST signed with
+	// HMAC-SHA256 over WebhookSecret
+	WebhookURLs   []string `yaml:"webhook_urls"`
+	WebhookSecret string   `yaml:"webhook_secret"`
+}
+
+func defaults() *Config {
+	return &Config{
+		Env:         EnvDevelopment,
+		ListenAddr:  ":8001",
+		FrontendURL: "http://localhost:3002/dashboard",
+		DB: DBConfig{
+			Port:              "5432",
+			SSLMode:           "disable",
+			MaxConns:          10,
+			MinConns:          2,
+			MaxConnIdleTime:   5 * time.Minute,
+			HealthCheckPeriod: 1 * time.Minute,
+		},
+		JWT: JWTConfig{
+			MaxAuthzClaimBytes: 2048,
+		},
+		Cookie: CookieConfig{
+			SameSite: "strict",
+		},
+		MFA: MFAConfig{
+			Issuer: "Device Monitor",
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:          "localhost",
+			RPDisplayName: "Device Monitor",
+			RPOrigins:     []string{"http://localhost:3002"},
+		},
+		Mail: MailConfig{
+			Driver: "log",
+			From:   "Device Monitor <no-reply@localhost>",
+			SMTP: SMTPConfig{
+				Port: "587",
+			},
+		},
+		EmailVerification: EmailVerificationConfig{
+			Policy:         UnverifiedRestrict,
+			URL:            "http://localhost:8001/verify-email",
+			TokenTTL:       24 * time.Hour,
+			ResendCooldown: time.Minute,
+		},
+		PasswordReset: PasswordResetConfig{
+			URL:            "http://localhost:3002/reset-password",
+			TokenTTL:       30 * time.Minute,
+			ResendCooldown: time.Minute,
+		},
+		PasswordPolicy: PasswordPolicyConfig{
+			MinLength:   8,
+			MaxLength:   128,
+			MinStrength: 2,
+			BannedWords: []string{"password", "devicemonitor"},
+		},
+		PasswordHash: PasswordHashConfig{
+			// OWASP's argon2id baseline: 19 MiB, two passes, one lane
+			Algorithm: "argon2id",
+			Argon2: Argon2Config{
+				Memory:      19 * 1024,
+				Iterations:  2,
+				Parallelism: 1,
+				SaltLength:  16,
+				KeyLength:   32,
+			},
+			BcryptCost: 12,
+		},
+		Lockout: LockoutConfig{
+			Account: LockoutLimits{
+				FreeAttempts: 3,
+				BaseDelay:    time.Second,
+				MaxDelay:     time.Minute,
+				Threshold:    10,
+				LockDuration: 15 * time.Minute,
+				Window:       time.Hour,
+			},
+			// A whole office can share one address
+			IP: LockoutLimits{
+				FreeAttempts: 20,
+				BaseDelay:    time.Second,
+				MaxDelay:     time.Minute,
+				Threshold:    100,
+				LockDuration: 15 * time.Minute,
+				Window:       time.Hour,
+			},
+			UnlockURL:      "http://localhost:8001/login/unlock",
+			UnlockTokenTTL: time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Backend: "memory",
+			Rules: map[string]RateLimitRule{
+				"register":        {Requests: 5, Period: time.Hour, Key: RateLimitByIP},
+				"login":           {Requests: 20, Period: time.Minute, Key: RateLimitByIP},
+				"login_mfa":       {Requests: 10, Period: time.Minute, Key: RateLimitByIP},
+				"google":          {Requests: 20, Period: time.Minute, Key: RateLimitByIP},
+				"webauthn_login":  {Requests: 20, Period: time.Minute, Key: RateLimitByIP},
+				"refresh":         {Requests: 60, Period: time.Minute, Key: RateLimitByIP},
+				"email":           {Requests: 5, Period: time.Hour, Key: RateLimitByIP},
+				"password_reset":  {Requests: 10, Period: time.Hour, Key: RateLimitByIP},
+				"password_change": {Requests: 10, Period: time.Hour, Key: RateLimitByUser},
+			},
+		},
+		AccountDeletion: AccountDeletionConfig{
+			GracePeriod: 14 * 24 * time.Hour,
+			Mode:        DeletionModeDelete,
+		},
+		Events: EventsConfig{
+			Driver: "log",
+		},
+	}
+}
+
+// Load builds the configuration from all layers and validates it
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("auth-service", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	listenAddr := fs.String("listen", "", "address to listen on, e.g. :8001")
+	env := fs.String("env", "", "environment profile: development or production")
+	ginMode := fs.String("gin-mode", "", "gin mode: debug, release or test")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaults()
+
+	// 1. File
+	if *configFile != "" {
+		raw, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config file: %v", err)
+		}
+		if err := yaml.Unmarshal(raw, cfg); err != nil {
+			return nil, fmt.Errorf("unable to parse config file: %v", err)
+		}
+	}
+
+	// 2. Environment
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	// 3. Flags that were given explicitly
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.ListenAddr = *listenAddr
+		case "env":
+			cfg.Env = *env
+		case "gin-mode":
+			cfg.GinMode = *ginMode
+		}
+	})
+
+	if cfg.GinMode == "" {
+		cfg.GinMode = "debug"
+		if cfg.Env == EnvProduction {
+			cfg.GinMode = "release"
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) applyEnv() error {
+	e := &envReader{}
+
+	e.str(&cfg.Env, "APP_ENV")
+	e.str(&cfg.ListenAddr, "LISTEN_ADDR")
+	e.str(&cfg.GinMode, "GIN_MODE")
+	e.list(&cfg.TrustedProxies, "TRUSTED_PROXIES")
+	e.str(&cfg.FrontendURL, "FRONTEND_URL")
+
+	e.str(&cfg.DB.Host, "DB_HOST")
+	e.str(&cfg.DB.Port, "DB_PORT")
+	e.str(&cfg.DB.User, "DB_USER")
+	e.str(&cfg.DB.Password, "DB_PASSWORD")
+	e.str(&cfg.DB.Name, "DB_NAME")
+	e.str(&cfg.DB.SSLMode, "DB_SSLMODE")
+	e.int32(&cfg.DB.MaxConns, "DB_MAX_CONNS")
+	e.int32(&cfg.DB.MinConns, "DB_MIN_CONNS")
+	e.duration(&cfg.DB.MaxConnIdleTime, "DB_MAX_CONN_IDLE_TIME")
+	e.duration(&cfg.DB.HealthCheckPeriod, "DB_HEALTH_CHECK_PERIOD")
+
+	e.str(&cfg.JWT.KeysDir, "JWT_KEYS_DIR")
+	e.str(&cfg.JWT.LegacySecret, "JWT_SECRET")
+	e.timestamp(&cfg.JWT.LegacyCutover, "JWT_LEGACY_CUTOVER")
+	e.list(&cfg.JWT.AccessAudiences, "JWT_ACCESS_AUDIENCES")
+	e.timestamp(&cfg.JWT.LegacyClaimsUntil, "JWT_LEGACY_CLAIMS_UNTIL")
+	e.int32(&cfg.JWT.MaxAuthzClaimBytes, "JWT_MAX_AUTHZ_CLAIM_BYTES")
+
+	e.str(&cfg.Cookie.Domain, "COOKIE_DOMAIN")
+	e.bool(&cfg.Cookie.Secure, "COOKIE_SECURE")
+	e.str(&cfg.Cookie.SameSite, "COOKIE_SAMESITE")
+
+	e.str(&cfg.Google.ClientID, "GOOGLE_CLIENT_ID")
+	e.str(&cfg.Google.ClientSecret, "GOOGLE_CLIENT_SECRET")
+	e.str(&cfg.Google.RedirectURL, "GOOGLE_REDIRECT_URL")
+
+	e.str(&cfg.Security.TokenHashKey, "TOKEN_HASH_KEY")
+	e.str(&cfg.Security.IntrospectionSecret, "INTROSPECTION_SECRET")
+	e.str(&cfg.Security.EncryptionKey, "ENCRYPTION_KEY")
+
+	e.str(&cfg.MFA.Issuer, "MFA_ISSUER")
+
+	e.str(&cfg.WebAuthn.RPID, "WEBAUTHN_RP_ID")
+	e.str(&cfg.WebAuthn.RPDisplayName, "WEBAUTHN_RP_DISPLAY_NAME")
+	e.list(&cfg.WebAuthn.RPOrigins, "WEBAUTHN_RP_ORIGINS")
+
+	e.str(&cfg.Mail.Driver, "MAIL_DRIVER")
+	e.str(&cfg.Mail.From, "MAIL_FROM")
+	e.str(&cfg.Mail.SMTP.Host, "SMTP_HOST")
+	e.str(&cfg.Mail.SMTP.Port, "SMTP_PORT")
+	e.str(&cfg.Mail.SMTP.Username, "SMTP_USERNAME")
+	e.str(&cfg.Mail.SMTP.Password, "SMTP_PASSWORD")
+
+	e.str(&cfg.EmailVerification.Policy, "EMAIL_VERIFICATION_POLICY")
+	e.str(&cfg.EmailVerification.URL, "EMAIL_VERIFICATION_URL")
+	e.duration(&cfg.EmailVerification.TokenTTL, "EMAIL_VERIFICATION_TOKEN_TTL")
+	e.duration(&cfg.EmailVerification.ResendCooldown, "EMAIL_VERIFICATION_RESEND_COOLDOWN")
+
+	e.str(&cfg.PasswordReset.URL, "PASSWORD_RESET_URL")
+	e.duration(&cfg.PasswordReset.TokenTTL, "PASSWORD_RESET_TOKEN_TTL")
+	e.duration(&cfg.PasswordReset.ResendCooldown, "PASSWORD_RESET_RESEND_COOLDOWN")
+
+	e.int32(&cfg.PasswordPolicy.MinLength, "PASSWORD_MIN_LENGTH")
+	e.int32(&cfg.PasswordPolicy.MaxLength, "PASSWORD_MAX_LENGTH")
+	e.int32(&cfg.PasswordPolicy.MinStrength, "PASSWORD_MIN_STRENGTH")
+	e.list(&cfg.PasswordPolicy.BannedWords, "PASSWORD_BANNED_WORDS")
+	e.str(&cfg.PasswordPolicy.BannedWordsFile, "PASSWORD_BANNED_WORDS_FILE")
+	e.str(&cfg.PasswordPolicy.BreachedPasswords, "PASSWORD_BREACHED_PASSWORDS")
+
+	e.str(&cfg.PasswordHash.Algorithm, "PASSWORD_HASH_ALGORITHM")
+	e.int32(&cfg.PasswordHash.Argon2.Memory, "PASSWORD_HASH_ARGON2_MEMORY")
+	e.int32(&cfg.PasswordHash.Argon2.Iterations, "PASSWORD_HASH_ARGON2_ITERATIONS")
+	e.int32(&cfg.PasswordHash.Argon2.Parallelism, "PASSWORD_HASH_ARGON2_PARALLELISM")
+	e.int32(&cfg.PasswordHash.BcryptCost, "PASSWORD_HASH_BCRYPT_COST")
+
+	e.int32(&cfg.Lockout.Account.Threshold, "LOCKOUT_ACCOUNT_THRESHOLD")
+	e.duration(&cfg.Lockout.Account.LockDuration, "LOCKOUT_ACCOUNT_LOCK_DURATION")
+	e.int32(&cfg.Lockout.IP.Threshold, "LOCKOUT_IP_THRESHOLD")
+	e.duration(&cfg.Lockout.IP.LockDuration, "LOCKOUT_IP_LOCK_DURATION")
+	e.str(&cfg.Lockout.UnlockURL, "LOCKOUT_UNLOCK_URL")
+	e.duration(&cfg.Lockout.UnlockTokenTTL, "LOCKOUT_UNLOCK_TOKEN_TTL")
+
+	e.bool(&cfg.RateLimit.Enabled, "RATE_LIMIT_ENABLED")
+	e.str(&cfg.RateLimit.Backend, "RATE_LIMIT_BACKEND")
+	e.str(&cfg.RateLimit.Redis.Addr, "REDIS_ADDR")
+	e.str(&cfg.RateLimit.Redis.Username, "REDIS_USERNAME")
+	e.str(&cfg.RateLimit.Redis.Password, "REDIS_PASSWORD")
+	e.int32(&cfg.RateLimit.Redis.DB, "REDIS_DB")
+
+	e.duration(&cfg.AccountDeletion.GracePeriod, "ACCOUNT_DELETION_GRACE_PERIOD")
+	e.str(&cfg.AccountDeletion.Mode, "ACCOUNT_DELETION_MODE")
+
+	e.str(&cfg.Events.Driver, "EVENTS_DRIVER")
+	e.list(&cfg.Events.WebhookURLs, "EVENTS_WEBHOOK_URLS")
+	e.str(&cfg.Events.WebhookSecret, "EVENTS_WEBHOOK_SECRET")
+
+	return errors.Join(e.errs...)
+}
+
+// Validate checks required values and, in production, refuses insecure defaults
+func (cfg *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if cfg.Env != EnvDevelopment && cfg.Env != EnvProduction {
+		fail("env must be %q or %q, got %q", EnvDevelopment, EnvProduction, cfg.Env)
+	}
+	if cfg.ListenAddr == "" {
+		fail("listen_addr is required")
+	}
+	switch cfg.GinMode {
+	case "debug", "release", "test":
+	default:
+		fail("gin_mode must be debug, release or test, got %q", cfg.GinMode)
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				fail("trusted_proxies entry %q is not an IP address or CIDR range", proxy)
+			}
+		}
+	}
+
+	if cfg.DB.Host == "" || cfg.DB.Port == "" || cfg.DB.User == "" || cfg.DB.Name == "" {
+		fail("db host, port, user and name are required")
+	}
+	if cfg.DB.MaxConns < 1 || cfg.DB.MinConns < 0 || cfg.DB.MinConns > cfg.DB.MaxConns {
+		fail("db pool sizes are invalid: min_conns=%d max_conns=%d", cfg.DB.MinConns, cfg.DB.MaxConns)
+	}
+
+	if cfg.JWT.LegacySecret != "" && (cfg.JWT.LegacyCutover.IsZero() || cfg.JWT.LegacyClaimsUntil.IsZero()) {
+		fail("jwt legacy_cutover and legacy_claims_until are required when legacy_secret is set")
+	}
+	if cfg.JWT.MaxAuthzClaimBytes < MinAuthzClaimBytes {
+		fail("jwt max_authz_claim_bytes must be at least %d", MinAuthzClaimBytes)
+	}
+
+	switch strings.ToLower(cfg.Cookie.SameSite) {
+	case "strict", "lax":
+	case "none":
+		if !cfg.Cookie.Secure {
+			fail("cookie same_site=none requires secure cookies")
+		}
+	default:
+		fail("cookie same_site must be strict, lax or none, got %q", cfg.Cookie.SameSite)
+	}
+
+	if cfg.MFA.Issuer == "" || strings.Contains(cfg.MFA.Issuer, ":") {
+		fail("mfa issuer is required and must not contain a colon")
+	}
+
+	if cfg.WebAuthn.RPID == "" || cfg.WebAuthn.RPDisplayName == "" || len(cfg.WebAuthn.RPOrigins) == 0 {
+		fail("webauthn rp_id, rp_display_name and rp_origins are required")
+	}
+
+	if cfg.Mail.From == "" {
+		fail("mail from is required")
+	}
+	switch cfg.Mail.Driver {
+	case "log":
+	case "smtp":
+		if cfg.Mail.SMTP.Host == "" || cfg.Mail.SMTP.Port == "" {
+			fail("mail smtp host and port are required for the smtp driver")
+		}
+	default:
+		fail("mail driver must be log or smtp, got %q", cfg.Mail.Driver)
+	}
+
+	switch cfg.EmailVerification.Policy {
+	case UnverifiedAllow, UnverifiedRestrict, UnverifiedDeny:
+	default:
+		fail("email_verification policy must be %s, %s or %s, got %q",
+			UnverifiedAllow, UnverifiedRestrict, UnverifiedDeny, cfg.EmailVerification.Policy)
+	}
+	if cfg.EmailVerification.URL == "" {
+		fail("email_verification url is required")
+	}
+	if cfg.EmailVerification.TokenTTL <= 0 || cfg.EmailVerification.ResendCooldown < 0 {
+		fail("email_verification token_ttl must be positive and resend_cooldown not negative")
+	}
+
+	if cfg.PasswordReset.URL == "" || cfg.PasswordReset.TokenTTL <= 0 {
+		fail("password_reset url and a positive token_ttl are required")
+	}
+	if cfg.PasswordReset.ResendCooldown < 0 {
+		fail("password_reset resend_cooldown must not be negative")
+	}
+
+	policy := cfg.PasswordPolicy
+	if policy.MinLength < 8 || policy.MaxLength < policy.MinLength {
+		fail("password_policy min_length must be at least 8 and max_length at least min_length")
+	}
+	if policy.MinStrength < 0 || policy.MinStrength > 4 {
+		fail("password_policy min_strength must be between 0 and 4, got %d", policy.MinStrength)
+	}
+
+	hashing := cfg.PasswordHash
+	switch hashing.Algorithm {
+	case "argon2id", "bcrypt":
+	default:
+		fail("password_hash algorithm must be argon2id or bcrypt, got %q", hashing.Algorithm)
+	}
+	argon := hashing.Argon2
+	if argon.Iterations < 1 || argon.Parallelism < 1 || argon.Parallelism > 255 || argon.Memory < 8*argon.Parallelism {
+		fail("password_hash argon2 needs iterations >= 1, parallelism 1-255 and memory >= 8 KiB per lane")
+	}
+	if argon.SaltLength < 16 || argon.KeyLength < 16 {
+		fail("password_hash argon2 salt_length and key_length must be at least 16 bytes")
+	}
+	if hashing.BcryptCost < 10 || hashing.BcryptCost > 31 {
+		fail("password_hash bcrypt_cost must be between 10 and 31, got %d", hashing.BcryptCost)
+	}
+
+	for _, scope := range []struct {
+		name   string
+		limits LockoutLimits
+	}{{"account", cfg.Lockout.Account}, {"ip", cfg.Lockout.IP}} {
+		name, limits := scope.name, scope.limits
+		if limits.FreeAttempts < 0 || limits.Threshold <= limits.FreeAttempts {
+			fail("lockout %s threshold must be above free_attempts", name)
+		}
+		if limits.BaseDelay <= 0 || limits.MaxDelay < limits.BaseDelay || limits.LockDuration <= 0 || limits.Window <= 0 {
+			fail("lockout %s delays, lock_duration and window must be positive, with max_delay at least base_delay", name)
+		}
+	}
+	if cfg.Lockout.UnlockURL == "" || cfg.Lockout.UnlockTokenTTL <= 0 {
+		fail("lockout unlock_url and a positive unlock_token_ttl are required")
+	}
+
+	if cfg.RateLimit.Enabled {
+		switch cfg.RateLimit.Backend {
+		case "memory":
+		case "redis":
+			if cfg.RateLimit.Redis.Addr == "" {
+				fail("rate_limit redis addr is required for the redis backend")
+			}
+		default:
+			fail("rate_limit backend must be memory or redis, got %q", cfg.RateLimit.Backend)
+		}
+		for _, name := range slices.Sorted(maps.Keys(cfg.RateLimit.Rules)) {
+			rule := cfg.RateLimit.Rules[name]
+			if rule.Requests <= 0 || rule.Period <= 0 {
+				fail("rate_limit rule %s needs positive requests and period", name)
+			}
+			switch rule.Key {
+			case RateLimitByIP, RateLimitByUser, RateLimitByRoute:
+			default:
+				fail("rate_limit rule %s key must be %s, %s or %s, got %q",
+					name, RateLimitByIP, RateLimitByUser, RateLimitByRoute, rule.Key)
+			}
+		}
+	}
+
+	if cfg.AccountDeletion.GracePeriod < 0 {
+		fail("account_deletion grace_period must not be negative")
+	}
+	switch cfg.AccountDeletion.Mode {
+	case DeletionModeDelete, DeletionModeAnonymize:
+	default:
+		fail("account_deletion mode must be %s or %s, got %q",
+			DeletionModeDelete, DeletionModeAnonymize, cfg.AccountDeletion.Mode)
+	}
+
+	switch cfg.Events.Driver {
+	case "log":
+	case "webhook":
+		if len(cfg.Events.WebhookURLs) == 0 || cfg.Events.WebhookSecret == "" {
+			fail("events webhook_urls and webhook_secret are required for the webhook driver")
+		}
+	default:
+		fail("events driver must be log or webhook, got %q", cfg.Events.Driver)
+	}
+
+	google := cfg.Google
+	if (google.ClientID != "" || google.ClientSecret != "" || google.RedirectURL != "") &&
+		(google.ClientID == "" || google.ClientSecret == "" || google.RedirectURL == "") {
+		fail("google client_id, client_secret and redirect_url must be set together")
+	}
+
+	if cfg.Env == EnvProduction {
+		if cfg.GinMode == "debug" {
+			fail("gin debug mode is not allowed in production")
+		}
+		if !cfg.Cookie.Secure {
+			fail("cookies must be secure in production")
+		}
+		if cfg.DB.Password == "" {
+			fail("db password is required in production")
+		}
+		if cfg.JWT.KeysDir == "" {
+			fail("jwt keys_dir is required in production; ephemeral signing keys are for development only")
+		}
+		if cfg.JWT.LegacySecret == devJWTSecret {
+			fail("jwt legacy_secret must not be the development secret in production")
+		}
+		if cfg.JWT.LegacySecret != "" && cfg.JWT.LegacyClaimsUntil.Before(time.Now()) {
+			fail("jwt legacy_claims_until has passed; remove legacy_secret instead")
+		}
+		if cfg.Security.TokenHashKey == "" || cfg.Security.TokenHashKey == security.DevTokenHashKey {
+			fail("security token_hash_key must be set in production")
+		}
+		if cfg.Security.IntrospectionSecret == "" {
+			fail("security introspection_secret must be set in production")
+		}
+		if cfg.Security.EncryptionKey == "" {
+			fail("security encryption_key must be set in production")
+		}
+		if cfg.Mail.Driver == "log" {
+			fail("mail driver log does not deliver email and is not allowed in production")
+		}
+		if !strings.HasPrefix(cfg.EmailVerification.URL, "https://") {
+			fail("email_verification url must use https in production")
+		}
+		if !strings.HasPrefix(cfg.PasswordReset.URL, "https://") {
+			fail("password_reset url must use https in production")
+		}
+		if !strings.HasPrefix(cfg.Lockout.UnlockURL, "https://") {
+			fail("lockout unlock_url must use https in production")
+		}
+		for _, url := range cfg.Events.WebhookURLs {
+			if !strings.HasPrefix(url, "https://") {
+				fail("events webhook_urls must use https in production, got %q", url)
+			}
+		}
+		for _, origin := range cfg.WebAuthn.RPOrigins {
+			if !strings.HasPrefix(origin, "https://") {
+				fail("webauthn rp_origins must use https in production, got %q", origin)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// envReader overrides config values from environment variables that are set
+// and collects parse errors instead of silently ignoring bad values.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) str(dst *string, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = v
+	}
+}
+
+func (e *envReader) list(dst *[]string, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		*dst = strings.Split(v, ",")
+	}
+}
+
+func (e *envReader) bool(dst *bool, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %v", key, err))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e *envReader) int32(dst *int32, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %v", key, err))
+			return
+		}
+		*dst = int32(n)
+	}
+}
+
+func (e *envReader) duration(dst *time.Duration, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %v", key, err))
+			return
+		}
+		*dst = d
+	}
+}
+
+func (e *envReader) timestamp(dst *time.Time, key string) {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %v", key, err))
+			return
+		}
+		*dst = t
+	}
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// development is the built-in profile with the database filled in
+func development() *Config {
+	cfg := defaults()
+	cfg.GinMode = "debug"
+	cfg.DB.Host = "localhost"
+	cfg.DB.User = "auth"
+	cfg.DB.Name = "auth"
+	return cfg
+}
+
+// production is a complete production configuration
+func production() *Config {
+	cfg := development()
+	cfg.Env = EnvProduction
+	cfg.GinMode = "release"
+	cfg.DB.Password = "db-password"
+	cfg.Cookie.Secure = true
+	cfg.JWT.KeysDir = "/etc/auth/keys"
+	cfg.Security = SecurityConfig{
+		TokenHashKey:        "token-hash-key",
+		IntrospectionSecret: "introspection-secret",
+		EncryptionKey:       "encryption-key",
+	}
+	cfg.Mail.Driver = "smtp"
+	cfg.Mail.SMTP.Host = "smtp.example.com"
+	cfg.EmailVerification.URL = "https://auth.example.com/verify-email"
+	cfg.PasswordReset.URL = "https://app.example.com/reset-password"
+	cfg.Lockout.UnlockURL = "https://auth.example.com/login/unlock"
+	cfg.WebAuthn.RPID = "example.com"
+	cfg.WebAuthn.RPOrigins = []string{"https://app.example.com"}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile func() *Config
+		change  func(*Config)
+		wantErr string // empty when the configuration is valid
+	}{
+		{"development defaults", development, func(*Config) {}, ""},
+		{"production", production, func(*Config) {}, ""},
+
+		{"unknown env", development, func(c *Config) { c.Env = "staging" }, "env must be"},
+		{"missing database", development, func(c *Config) { c.DB.Host = "" }, "db host, port, user and name are required"},
+		{"min conns above max", development, func(c *Config) { c.DB.MinConns = 20 }, "db pool sizes are invalid"},
+		{"same_site none over http", development, func(c *Config) { c.Cookie.SameSite = "none" }, "requires secure cookies"},
+		{"colon in mfa issuer", development, func(c *Config) { c.MFA.Issuer = "Acme: Auth" }, "mfa issuer"},
+		{"smtp without host", development, func(c *Config) { c.Mail.Driver = "smtp" }, "mail smtp host and port are required"},
+		{"unknown verification policy", development, func(c *Config) { c.EmailVerification.Policy = "maybe" }, "email_verification policy"},
+		{"short passwords", development, func(c *Config) { c.PasswordPolicy.MinLength = 6 }, "min_length must be at least 8"},
+		{"cheap bcrypt", development, func(c *Config) { c.PasswordHash.BcryptCost = 4 }, "bcrypt_cost must be between 10 and 31"},
+		{"tiny argon2 salt", development, func(c *Config) { c.PasswordHash.Argon2.SaltLength = 8 }, "salt_length and key_length"},
+		{"lockout below free attempts", development, func(c *Config) { c.Lockout.Account.Threshold = 2 }, "lockout account threshold"},
+		{"lockout max below base", development, func(c *Config) { c.Lockout.IP.MaxDelay = time.Millisecond }, "lockout ip delays"},
+		{"redis without addr", development, func(c *Config) { c.RateLimit.Backend = "redis" }, "rate_limit redis addr is required"},
+		{"rule without period", development, func(c *Config) {
+			c.RateLimit.Rules["login"] = RateLimitRule{Requests: 5, Key: RateLimitByIP}
+		}, "rate_limit rule login needs positive requests and period"},
+		{"rate limits off skip rules", development, func(c *Config) {
+			c.RateLimit.Enabled = false
+			c.RateLimit.Backend = "memcached"
+		}, ""},
+		{"webhook without secret", development, func(c *Config) {
+			c.Events.Driver = "webhook"
+			c.Events.WebhookURLs = []string{"http://localhost:9000/events"}
+		}, "events webhook_urls and webhook_secret are required"},
+		{"legacy secret without cutover", development, func(c *Config) { c.JWT.LegacySecret = "old-secret" }, "jwt legacy_cutover and legacy_claims_until are required"},
+		{"legacy window after it closed", development, func(c *Config) {
+			c.JWT.LegacySecret = "old-secret"
+			c.JWT.LegacyCutover = time.Now().Add(-30 * 24 * time.Hour)
+			c.JWT.LegacyClaimsUntil = time.Now().Add(-time.Hour)
+		}, ""},
+		{"half a google client", development, func(c *Config) { c.Google.ClientID = "client" }, "google client_id, client_secret and redirect_url"},
+
+		{"debug in production", production, func(c *Config) { c.GinMode = "debug" }, "gin debug mode is not allowed"},
+		{"insecure cookies in production", production, func(c *Config) { c.Cookie.Secure = false }, "cookies must be secure"},
+		{"ephemeral keys in production", production, func(c *Config) { c.JWT.KeysDir = "" }, "jwt keys_dir is required"},
+		{"legacy window without an end in production", production, func(c *Config) {
+			c.JWT.LegacySecret = "old-secret"
+			c.JWT.LegacyCutover = time.Now().Add(-time.Hour)
+		}, "legacy_claims_until are required"},
+		{"legacy window closed in production", production, func(c *Config) {
+			c.JWT.LegacySecret = "old-secret"
+			c.JWT.LegacyCutover = time.Now().Add(-30 * 24 * time.Hour)
+			c.JWT.LegacyClaimsUntil = time.Now().Add(-time.Hour)
+		}, "legacy_claims_until has passed"},
+		{"dev legacy secret in production", production, func(c *Config) { c.JWT.LegacySecret = devJWTSecret }, "legacy_secret must not be the development secret"},
+		{"log mailer in production", production, func(c *Config) { c.Mail.Driver = "log" }, "mail driver log"},
+		{"no room for authorization claims", development, func(c *Config) { c.JWT.MaxAuthzClaimBytes = 0 }, "jwt max_authz_claim_bytes must be at least 256"},
+		{"smallest authorization claims", development, func(c *Config) { c.JWT.MaxAuthzClaimBytes = MinAuthzClaimBytes }, ""},
+		{"trusted proxy range", development, func(c *Config) { c.TrustedProxies = []string{"10.0.0.0/8", "192.168.1.10", "::1"} }, ""},
+		{"trusted proxy hostname", development, func(c *Config) { c.TrustedProxies = []string{"lb.internal"} }, "trusted_proxies entry \"lb.internal\" is not an IP address"},
+		{"negative reset cooldown", development, func(c *Config) { c.PasswordReset.ResendCooldown = -time.Second }, "password_reset resend_cooldown must not be negative"},
+		{"http reset link in production", production, func(c *Config) { c.PasswordReset.URL = "http://app.example.com/reset" }, "password_reset url must use https"},
+		{"http origin in production", production, func(c *Config) {
+			c.WebAuthn.RPOrigins = append(c.WebAuthn.RPOrigins, "http://app.example.com")
+		}, "webauthn rp_origins must use https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.profile()
+			tt.change(cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("no error, want %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("error %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := development()
+	cfg.ListenAddr = ""
+	cfg.Mail.From = ""
+	cfg.AccountDeletion.Mode = "shred"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, want := range []string{"listen_addr is required", "mail from is required", "account_deletion mode"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadLayers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "listen_addr: \":9000\"\n" +
+		"db:\n  host: db.internal\n  user: auth\n  name: auth\n" +
+		"password_policy:\n  min_length: 12\n"
+	if err := os.WriteFile(file, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("DB_HOST", "db.override")
+	t.Setenv("LISTEN_ADDR", ":9100")
+
+	cfg, err := Load([]string{"-listen", ":9200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags beat the environment, which beats the file, which beats defaults
+	if cfg.ListenAddr != ":9200" {
+		t.Errorf("listen_addr %q, want the flag", cfg.ListenAddr)
+	}
+	if cfg.DB.Host != "db.override" {
+		t.Errorf("db host %q, want the environment", cfg.DB.Host)
+	}
+	if cfg.PasswordPolicy.MinLength != 12 {
+		t.Errorf("min_length %d, want the file", cfg.PasswordPolicy.MinLength)
+	}
+	if cfg.PasswordPolicy.MaxLength != 128 || cfg.GinMode != "debug" {
+		t.Errorf("max_length %d and gin mode %q, want the defaults", cfg.PasswordPolicy.MaxLength, cfg.GinMode)
+	}
+}
+
+func TestLoadRejectsBadEnvironment(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_USER", "auth")
+	t.Setenv("DB_NAME", "auth")
+	t.Setenv("DB_MAX_CONNS", "lots")
+
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "DB_MAX_CONNS") {
+		t.Errorf("error %v, want one naming DB_MAX_CONNS", err)
+	}
+}
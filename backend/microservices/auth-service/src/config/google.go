@@ -1,18 +1,8 @@
 // src/config/google.go
 package config
 
-import "os"
-
 type GoogleConfig struct {
-	ClientID     string
-	ClientSecret string
-	RedirectURL  string
-}
-
-func LoadGoogleConfig() GoogleConfig {
-	return GoogleConfig{
-		ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
-		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-		RedirectURL:  os.Getenv("GOOGLE_REDIRECT_URL"),
-	}
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	RedirectURL  string `yaml:"redirect_url"`
 }
@@ -0,0 +1,424 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"auth-service/src/config"
+	generated "auth-service/src/db/generated"
+	"auth-service/src/events"
+)
+
+const (
+	purgeBatchSize = 50
+	relayBatchSize = 100
+	relayTimeout   = 30 * time.Second // per event
+	relayLease     = 5 * time.Minute  // per batch
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// AccountExport is everything the service holds about a user, as returned
+// by GET /me/export
+type AccountExport struct {
+	ExportedAt  time.Time                         `json:"exported_at"`
+	Account     ExportedAccount                   `json:"account"`
+	Roles       []string                          `json:"roles"`
+	Sessions    []generated.ListSessionsByUserRow `json:"sessions"`
+	Devices     []generated.Device                `json:"devices"`
+	Passkeys    []PasskeyResponse                 `json:"passkeys"`
+	MFA         ExportedMFA                       `json:"mfa"`
+	AuditEvents []ExportedAuditEvent              `json:"audit_events"`
+}
+
+type ExportedAccount struct {
+	ID                   pgtype.UUID      `json:"id"`
+	Email                string           `json:"email"`
+	EmailVerified        bool             `json:"email_verified"`
+	EmailVerifiedAt      pgtype.Timestamp `json:"email_verified_at"`
+	HasPassword          bool             `json:"has_password"`
+	OauthProvider        pgtype.Text      `json:"oauth_provider"`
+	OauthProviderID      pgtype.Text      `json:"oauth_provider_id"`
+	RiskScore            pgtype.Int4      `json:"risk_score"`
+	CreatedAt            pgtype.Timestamp `json:"created_at"`
+	UpdatedAt            pgtype.Timestamp `json:"updated_at"`
+	DeletionScheduledFor pgtype.Timestamp `json:"deletion_scheduled_for"`
+}
+
+type ExportedMFA struct {
+	Enabled                bool  `json:"enabled"`
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+type ExportedAuditEvent struct {
+	EventType string           `json:"event_type"`
+	IpAddress pgtype.Text      `json:"ip_address"`
+	UserAgent pgtype.Text      `json:"user_agent"`
+	Metadata  json.RawMessage  `json:"metadata,omitempty"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+// ExportMe returns a machine-readable copy of the caller's personal data as
+// a JSON download.
+func (ac *AuthController) ExportMe(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	export, err := ac.collectExport(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to collect account export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not export account data"})
+		return
+	}
+
+	ac.audit(c, userID, AuditAccountExported, nil)
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-export-%s.json"`, export.ExportedAt.Format("2006-01-02")))
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, export)
+}
+
+func (ac *AuthController) collectExport(ctx context.Context, userID pgtype.UUID) (AccountExport, error) {
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return AccountExport{}, fmt.Errorf("load user: %w", err)
+	}
+	export := AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Account: ExportedAccount{
+			ID:                   user.ID,
+			Email:                user.Email,
+			EmailVerified:        user.EmailVerified,
+			EmailVerifiedAt:      user.EmailVerifiedAt,
+			HasPassword:          user.PasswordHash.Valid && user.PasswordHash.String != "",
+			OauthProvider:        user.OauthProvider,
+			OauthProviderID:      user.OauthProviderID,
+			RiskScore:            user.RiskScore,
+			CreatedAt:            user.CreatedAt,
+			UpdatedAt:            user.UpdatedAt,
+			DeletionScheduledFor: user.DeletionScheduledFor,
+		},
+		MFA: ExportedMFA{Enabled: user.MfaEnabled.Bool},
+	}
+
+	if export.Roles, err = ac.db.GetUserRoleNames(ctx, userID); err != nil {
+		return AccountExport{}, fmt.Errorf("list roles: %w", err)
+	}
+	if export.Sessions, err = ac.db.ListSessionsByUser(ctx, userID); err != nil {
+		return AccountExport{}, fmt.Errorf("list sessions: %w", err)
+	}
+	if export.Devices, err = ac.db.ListDevicesByUser(ctx, userID); err != nil {
+		return AccountExport{}, fmt.Errorf("list devices: %w", err)
+	}
+
+	credentials, err := ac.db.ListWebauthnCredentialsByUser(ctx, userID)
+	if err != nil {
+		return AccountExport{}, fmt.Errorf("list passkeys: %w", err)
+	}
+	export.Passkeys = make([]PasskeyResponse, 0, len(credentials))
+	for _, row := range credentials {
+		export.Passkeys = append(export.Passkeys, passkeyResponse(row))
+	}
+
+	if user.MfaEnabled.Bool {
+		if export.MFA.RecoveryCodesRemaining, err = ac.db.CountUnusedRecoveryCodes(ctx, userID); err != nil {
+			return AccountExport{}, fmt.Errorf("count recovery codes: %w", err)
+		}
+	}
+
+	auditEvents, err := ac.db.ListAuditEventsByUser(ctx, userID)
+	if err != nil {
+		return AccountExport{}, fmt.Errorf("list audit events: %w", err)
+	}
+	export.AuditEvents = make([]ExportedAuditEvent, 0, len(auditEvents))
+	for _, row := range auditEvents {
+		export.AuditEvents = append(export.AuditEvents, ExportedAuditEvent{
+			EventType: row.EventType,
+			IpAddress: row.IpAddress,
+			UserAgent: row.UserAgent,
+			Metadata:  row.Metadata,
+			CreatedAt: row.CreatedAt,
+		})
+	}
+
+	return export, nil
+}
+
+// DeleteMe schedules the caller's account for deletion after the configured
+// grace period and signs it out everywhere. Logging in again before the
+// period runs out cancels the deletion.
+func (ac *AuthController) DeleteMe(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	// 1. Load the user
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user during account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if user.DeletionScheduledFor.Valid {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":                  "Account deletion is already scheduled",
+			"deletion_scheduled_for": user.DeletionScheduledFor.Time,
+		})
+		return
+	}
+
+	// 2. Re-authenticate
+	if !ac.confirmIdentity(c, user, req.Password, req.Code, "confirm account deletion") {
+		return
+	}
+
+	// 3. Schedule the deletion and sign out everywhere
+	scheduledFor := time.Now().Add(ac.cfg.AccountDeletion.GracePeriod)
+	var revoked int64
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		_, err := q.ScheduleUserDeletion(ctx, generated.ScheduleUserDeletionParams{
+			ID:                   userID,
+			DeletionScheduledFor: pgtype.Timestamp{Time: scheduledFor, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.InvalidatePasswordResetTokens(ctx, userID); err != nil {
+			return err
+		}
+		revoked, err = q.RevokeUserSessions(ctx, userID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to schedule account deletion: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	// 4. Tell the user and respond
+	ac.audit(c, userID, AuditAccountDeletionScheduled, gin.H{
+		"scheduled_for":    scheduledFor.UTC(),
+		"revoked_sessions": revoked,
+	})
+	ac.notify(user.Email, "Your account is scheduled for deletion",
+		fmt.Sprintf("Your account and its data will be permanently deleted on %s.\n\n"+
+			"Changed your mind? Just sign in before then and the deletion is cancelled. "+
+			"If you did not ask for this, sign in and change your password immediately.",
+			scheduledFor.UTC().Format("2 January 2006 at 15:04 MST")))
+
+	ac.clearAuthCookies(c)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":                "Account scheduled for deletion; sign in before the date below to cancel",
+		"deletion_scheduled_for": scheduledFor.UTC(),
+	})
+}
+
+// cancelPendingDeletion is called on every successful login: signing in
+// during the grace period keeps the account.
+func (ac *AuthController) cancelPendingDeletion(c *gin.Context, user generated.User) {
+	if !user.DeletionScheduledFor.Valid {
+		return
+	}
+
+	cancelled, err := ac.db.CancelUserDeletion(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("Failed to cancel account deletion for user %v: %v", user.ID, err)
+		return
+	}
+	if cancelled == 0 {
+		return
+	}
+
+	ac.audit(c, user.ID, AuditAccountDeletionCancelled, nil)
+	ac.notify(user.Email, "Your account deletion was cancelled",
+		"You signed in, so your account will not be deleted after all.\n\n"+
+			"If that was not you, change your password and review your active sessions immediately.")
+}
+
+// RunAccountMaintenance purges accounts whose grace period is over, delivers
+// pending events and forgets old login failures, every interval until ctx is
+// cancelled.
+func (ac *AuthController) RunAccountMaintenance(ctx context.Context, publisher events.Publisher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := ac.purgeDueAccounts(ctx); err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		}
+		if err := ac.relayEvents(ctx, publisher); err != nil {
+			log.Printf("Failed to relay events: %v", err)
+		}
+		if err := ac.purgeLoginThrottles(ctx); err != nil {
+			log.Printf("Failed to purge login throttles: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDueAccounts deletes or anonymises a batch of accounts past their
+// grace period. The user.deleted event is written to the outbox in the same
+// transaction, so it goes out if and only if the data is really gone.
+func (ac *AuthController) purgeDueAccounts(ctx context.Context) error {
+	mode := ac.cfg.AccountDeletion.Mode
+
+	var purged []generated.ListUsersDueForDeletionRow
+	err := ac.withTx(ctx, func(q *generated.Queries) error {
+		due, err := q.ListUsersDueForDeletion(ctx, purgeBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range due {
+			event, err := events.NewEvent(events.UserDeleted, gin.H{"user_id": user.ID, "mode": mode})
+			if err != nil {
+				return err
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			err = q.CreateOutboxEvent(ctx, generated.CreateOutboxEventParams{
+				EventType: event.Type,
+				Payload:   payload,
+			})
+			if err != nil {
+				return err
+			}
+
+			// The audit trail outlives the account, minus where it was used from
+			if err := q.ScrubUserAuditEvents(ctx, user.ID); err != nil {
+				return err
+			}
+			metadata, err := json.Marshal(gin.H{"mode": mode})
+			if err != nil {
+				return err
+			}
+			err = q.CreateAuditEvent(ctx, generated.CreateAuditEventParams{
+				UserID:    user.ID,
+				EventType: AuditAccountDeleted,
+				Metadata:  metadata,
+			})
+			if err != nil {
+				return err
+			}
+
+			if mode == config.DeletionModeAnonymize {
+				err = q.AnonymizeUser(ctx, user.ID)
+			} else {
+				err = q.DeleteUser(ctx, user.ID)
+			}
+			if err != nil {
+				return fmt.Errorf("purge user %v: %w", user.ID, err)
+			}
+		}
+		purged = due
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, user := range purged {
+		log.Printf("Purged account %v (%s)", user.ID, mode)
+		ac.notify(user.Email, "Your account has been deleted",
+			"As you asked, your account and the personal data we held for it have now been deleted.")
+	}
+	return nil
+}
+
+// relayEvents publishes pending outbox events in order. The batch is leased
+// in one short statement and delivered outside any transaction, so a slow
+// receiver holds neither a connection nor row locks; if the relay dies
+// mid-batch the lease runs out and another run picks the events up. Delivery
+// stops at the first failure so consumers never see events out of order; the
+// failed event and the rest of the batch are retried on the next run.
+func (ac *AuthController) relayEvents(ctx context.Context, publisher events.Publisher) error {
+	// 1. Lease a batch
+	pending, err := ac.db.ClaimOutboxEvents(ctx, generated.ClaimOutboxEventsParams{
+		LeaseSeconds: int32(relayLease.Seconds()),
+		BatchSize:    relayBatchSize,
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortStableFunc(pending, func(a, b generated.OutboxEvent) int {
+		return a.CreatedAt.Time.Compare(b.CreatedAt.Time)
+	})
+
+	// 2. Deliver them one by one before the lease runs out, recording each
+	// result on its own
+	deliverCtx, cancel := context.WithTimeout(ctx, relayLease)
+	defer cancel()
+
+	for i, row := range pending {
+		if err := publishOutboxEvent(deliverCtx, publisher, row); err != nil {
+			log.Printf("Failed to publish outbox event %v (attempt %d): %v", row.ID, row.Attempts, err)
+			if err := ac.db.RecordOutboxEventFailure(ctx, row.ID); err != nil {
+				log.Printf("Failed to record outbox event failure: %v", err)
+			}
+			return ac.releaseOutboxEvents(ctx, pending[i+1:])
+		}
+
+		if err := ac.db.MarkOutboxEventPublished(ctx, row.ID); err != nil {
+			return errors.Join(err, ac.releaseOutboxEvents(ctx, pending[i+1:]))
+		}
+	}
+	return nil
+}
+
+func publishOutboxEvent(ctx context.Context, publisher events.Publisher, row generated.OutboxEvent) error {
+	var event events.Event
+	if err := json.Unmarshal(row.Payload, &event); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	publishCtx, cancel := context.WithTimeout(ctx, relayTimeout)
+	defer cancel()
+	return publisher.Publish(publishCtx, event)
+}
+
+// releaseOutboxEvents ends the lease on events that were not tried, so the
+// next run does not have to wait for it to run out
+func (ac *AuthController) releaseOutboxEvents(ctx context.Context, rows []generated.OutboxEvent) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	ids := make([]pgtype.UUID, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	return ac.db.ReleaseOutboxEvents(ctx, ids)
+}
@@ -0,0 +1,444 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/password"
+)
+
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+// Sign-in methods the user list can be filtered by. Accounts without an
+// OAuth provider are "password" accounts.
+var userProviders = []string{"password", "google"}
+
+type AdminUserSummary struct {
+	ID                   pgtype.UUID `json:"id"`
+	Email                string      `json:"email"`
+	Provider             string      `json:"provider"`
+	EmailVerified        bool        `json:"email_verified"`
+	MfaEnabled           bool        `json:"mfa_enabled"`
+	RiskScore            int32       `json:"risk_score"`
+	Roles                []string    `json:"roles"`
+	CreatedAt            time.Time   `json:"created_at"`
+	DeletionScheduledFor *time.Time  `json:"deletion_scheduled_for"`
+}
+
+type AdminUserDetail struct {
+	AdminUserSummary
+	HasPassword           bool       `json:"has_password"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	EmailVerifiedAt       *time.Time `json:"email_verified_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+type AdminDeviceResponse struct {
+	ID        pgtype.UUID `json:"id"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	IPAddress string      `json:"ip_address"`
+	LastSeen  time.Time   `json:"last_seen"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// ListUsers pages through accounts, newest first. Query parameters:
+//
+//	email           email address prefix, case-insensitive
+//	provider        password or google
+//	role            role name
+//	created_after   RFC 3339 time, inclusive
+//	created_before  RFC 3339 time, exclusive
+//	min_risk        lowest risk score
+//	max_risk        highest risk score
+//	limit           page size, 1 to 200
+//	cursor          next_cursor from the previous page
+func (ac *AuthController) ListUsers(c *gin.Context) {
+	params, limit, err := parseUserFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "error_code": "invalid_filter"})
+		return
+	}
+
+	// One extra row tells whether there is another page
+	params.PageSize = int32(limit + 1)
+	rows, err := ac.db.ListUsers(c.Request.Context(), params)
+	if err != nil {
+		log.Printf("DATABASE ERROR in ListUsers: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch users"})
+		return
+	}
+
+	var nextCursor string
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		nextCursor = encodeUserCursor(last.CreatedAt.Time, last.ID)
+	}
+
+	users := make([]AdminUserSummary, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, AdminUserSummary{
+			ID:                   row.ID,
+			Email:                row.Email,
+			Provider:             providerOf(row.OauthProvider),
+			EmailVerified:        row.EmailVerified,
+			MfaEnabled:           row.MfaEnabled.Bool,
+			RiskScore:            row.RiskScore.Int32,
+			Roles:                row.Roles,
+			CreatedAt:            row.CreatedAt.Time,
+			DeletionScheduledFor: timeOrNil(row.DeletionScheduledFor),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users, "next_cursor": nextCursor})
+}
+
+// GetUser returns one account with its roles, devices and active sessions
+func (ac *AuthController) GetUser(c *gin.Context) {
+	user, ok := ac.adminTargetUser(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	roles, err := ac.db.GetUserRoleNames(ctx, user.ID)
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetUserRoleNames: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch user"})
+		return
+	}
+	deviceRows, err := ac.db.ListDevicesByUser(ctx, user.ID)
+	if err != nil {
+		log.Printf("DATABASE ERROR in ListDevicesByUser: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch user"})
+		return
+	}
+	sessionRows, err := ac.db.ListActiveSessionsByUser(ctx, user.ID)
+	if err != nil {
+		log.Printf("DATABASE ERROR in ListActiveSessionsByUser: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch user"})
+		return
+	}
+
+	if roles == nil {
+		roles = []string{}
+	}
+	detail := AdminUserDetail{
+		AdminUserSummary: AdminUserSummary{
+			ID:                   user.ID,
+			Email:                user.Email,
+			Provider:             providerOf(user.OauthProvider),
+			EmailVerified:        user.EmailVerified,
+			MfaEnabled:           user.MfaEnabled.Bool,
+			RiskScore:            user.RiskScore.Int32,
+			Roles:                roles,
+			CreatedAt:            user.CreatedAt.Time,
+			DeletionScheduledFor: timeOrNil(user.DeletionScheduledFor),
+		},
+		HasPassword:           user.PasswordHash.Valid && user.PasswordHash.String != "",
+		PasswordResetRequired: user.PasswordHash.String == password.ResetRequired,
+		EmailVerifiedAt:       timeOrNil(user.EmailVerifiedAt),
+		UpdatedAt:             user.UpdatedAt.Time,
+	}
+
+	devices := make([]AdminDeviceResponse, 0, len(deviceRows))
+	for _, d := range deviceRows {
+		devices = append(devices, AdminDeviceResponse{
+			ID:        d.ID,
+			Name:      d.DeviceName.String,
+			Type:      d.DeviceType.String,
+			IPAddress: d.IpAddress.String,
+			LastSeen:  d.LastSeen.Time,
+			CreatedAt: d.CreatedAt.Time,
+		})
+	}
+
+	sessions := make([]SessionResponse, 0, len(sessionRows))
+	for _, row := range sessionRows {
+		session := SessionResponse{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt.Time,
+			UpdatedAt: row.UpdatedAt.Time,
+			ExpiresAt: row.ExpiresAt.Time,
+		}
+		if row.DeviceID.Valid {
+			session.Device = &SessionDeviceResponse{
+				ID:        row.DeviceID,
+				Name:      row.DeviceName.String,
+				Type:      row.DeviceType.String,
+				IPAddress: row.IpAddress.String,
+				LastSeen:  row.LastSeen.Time,
+			}
+		}
+		sessions = append(sessions, session)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": detail, "devices": devices, "sessions": sessions})
+}
+
+// ForceLogout revokes every session of the user. Access tokens already
+// issued stay valid until they expire.
+func (ac *AuthController) ForceLogout(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+	user, ok := ac.adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	revoked, err := ac.db.RevokeUserSessions(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("DATABASE ERROR in RevokeUserSessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log the user out"})
+		return
+	}
+
+	ac.audit(c, user.ID, AuditSessionsRevokedByAdmin, gin.H{"revoked_sessions": revoked, "by": actorID})
+	c.JSON(http.StatusOK, gin.H{"message": "User logged out everywhere", "revoked_sessions": revoked})
+}
+
+// ForcePasswordReset makes the user's password stop working, logs them out
+// and mails them a link to choose a new one. The hash is replaced by
+// password.ResetRequired rather than cleared, so the account keeps going
+// through the password reset flow and is not mistaken for one that never had
+// a password. Passkeys and Google sign-in are left alone.
+func (ac *AuthController) ForcePasswordReset(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+	user, ok := ac.adminTargetUser(c)
+	if !ok {
+		return
+	}
+	if !user.PasswordHash.Valid || user.PasswordHash.String == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "The account does not use a password", "error_code": "no_password"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 1. Drop the password, earlier reset links and every session together
+	var token string
+	var revoked int64
+	err := ac.withTx(ctx, func(q *generated.Queries) error {
+		err := q.UpdateUserPassword(ctx, generated.UpdateUserPasswordParams{
+			ID:           user.ID,
+			PasswordHash: pgtype.Text{String: password.ResetRequired, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.InvalidatePasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		if revoked, err = q.RevokeUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+		token, err = ac.issuePasswordResetToken(ctx, q, user.ID, 0)
+		if err == nil && token == "" {
+			err = errors.New("reset token was not stored")
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("DATABASE ERROR forcing a password reset for user %v: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset the password"})
+		return
+	}
+
+	// 2. Tell the user how to get back in
+	link, err := ac.passwordResetLink(token)
+	if err != nil {
+		log.Printf("Invalid password reset URL: %v", err)
+	} else {
+		ac.notify(user.Email, "Your password has been reset",
+			fmt.Sprintf("An administrator has reset the password for your account and signed you out everywhere. "+
+				"To choose a new password, open the link below:\n\n%s\n\n"+
+				"The link works once and expires in %s. After that, use \"Forgot password\" to get a new one.",
+				link, ac.cfg.PasswordReset.TokenTTL))
+	}
+
+	ac.audit(c, user.ID, AuditPasswordResetForced, gin.H{"revoked_sessions": revoked, "by": actorID})
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Password reset; the user has been emailed a link to choose a new one",
+		"revoked_sessions": revoked,
+	})
+}
+
+// UnlockUser lifts a login lockout on the account before it runs out
+func (ac *AuthController) UnlockUser(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+	user, ok := ac.adminTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.lockout.Reset(c.Request.Context(), user.Email); err != nil {
+		log.Printf("Failed to unlock user %v: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock the account"})
+		return
+	}
+
+	ac.audit(c, user.ID, AuditAccountUnlocked, gin.H{"by": actorID})
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked"})
+}
+
+// adminTargetUser loads the account named by the :id parameter. Deleted
+// accounts count as missing. When it fails it has already answered.
+func (ac *AuthController) adminTargetUser(c *gin.Context) (generated.User, bool) {
+	var userID pgtype.UUID
+	if err := userID.Scan(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return generated.User{}, false
+	}
+
+	user, err := ac.db.GetUserByID(c.Request.Context(), userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && user.DeletedAt.Valid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return generated.User{}, false
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetUserByID: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch user"})
+		return generated.User{}, false
+	}
+	return user, true
+}
+
+// parseUserFilters reads the ListUsers query parameters
+func parseUserFilters(c *gin.Context) (generated.ListUsersParams, int, error) {
+	var params generated.ListUsersParams
+
+	limit := defaultUserPageSize
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxUserPageSize {
+			return params, 0, fmt.Errorf("limit must be between 1 and %d", maxUserPageSize)
+		}
+		limit = n
+	}
+
+	if prefix := strings.TrimSpace(c.Query("email")); prefix != "" {
+		params.EmailPrefix = pgtype.Text{String: prefix, Valid: true}
+	}
+	if provider := c.Query("provider"); provider != "" {
+		if !slices.Contains(userProviders, provider) {
+			return params, 0, fmt.Errorf("provider must be one of %s", strings.Join(userProviders, ", "))
+		}
+		params.Provider = pgtype.Text{String: provider, Valid: true}
+	}
+	if role := c.Query("role"); role != "" {
+		params.Role = pgtype.Text{String: role, Valid: true}
+	}
+
+	times := []struct {
+		name string
+		dst  *pgtype.Timestamp
+	}{
+		{"created_after", &params.CreatedAfter},
+		{"created_before", &params.CreatedBefore},
+	}
+	for _, f := range times {
+		if raw := c.Query(f.name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return params, 0, fmt.Errorf("%s must be an RFC 3339 time", f.name)
+			}
+			*f.dst = pgtype.Timestamp{Time: t.UTC(), Valid: true}
+		}
+	}
+	scores := []struct {
+		name string
+		dst  *pgtype.Int4
+	}{
+		{"min_risk", &params.MinRisk},
+		{"max_risk", &params.MaxRisk},
+	}
+	for _, f := range scores {
+		if raw := c.Query(f.name); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 32)
+			if err != nil {
+				return params, 0, fmt.Errorf("%s must be an integer", f.name)
+			}
+			*f.dst = pgtype.Int4{Int32: int32(n), Valid: true}
+		}
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		createdAt, id, err := decodeUserCursor(raw)
+		if err != nil {
+			return params, 0, errors.New("cursor is invalid")
+		}
+		params.CursorCreatedAt = pgtype.Timestamp{Time: createdAt, Valid: true}
+		params.CursorID = id
+	}
+	return params, limit, nil
+}
+
+// User list cursors are "<created_at in unix microseconds>:<id>", base64url
+// encoded so clients treat them as opaque
+func encodeUserCursor(createdAt time.Time, id pgtype.UUID) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%s", createdAt.UnixMicro(), id.String()))
+}
+
+func decodeUserCursor(cursor string) (time.Time, pgtype.UUID, error) {
+	var id pgtype.UUID
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, id, err
+	}
+	micros, rawID, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, id, errors.New("malformed cursor")
+	}
+	n, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return time.Time{}, id, err
+	}
+	if err := id.Scan(rawID); err != nil {
+		return time.Time{}, id, err
+	}
+	return time.UnixMicro(n).UTC(), id, nil
+}
+
+func providerOf(oauthProvider pgtype.Text) string {
+	if oauthProvider.Valid && oauthProvider.String != "" {
+		return oauthProvider.String
+	}
+	return "password"
+}
+
+func timeOrNil(ts pgtype.Timestamp) *time.Time {
+	if !ts.Valid {
+		return nil
+	}
+	return &ts.Time
+}
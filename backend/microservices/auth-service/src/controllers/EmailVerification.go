@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"auth-service/src/config"
+	generated "auth-service/src/db/generated"
+	jwt "auth-service/src/utils"
+)
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VerifyEmail handles the link from the verification email and sends the
+// browser on to the frontend with ?email_verified=true or false.
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. The token must be a valid, unexpired verification token
+	claims, err := jwt.ValidateToken(c.Query("token"), jwt.AudienceAuth)
+	if err != nil || claims.Type != jwt.TokenTypeEmailVerification {
+		ac.redirectWithOutcome(c, "email_verified", false)
+		return
+	}
+
+	// 2. ...for the address the account still has
+	user, err := ac.db.GetUserByID(ctx, claims.UserID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && user.Email != claims.Email) {
+		ac.redirectWithOutcome(c, "email_verified", false)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load user during email verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 3. Mark verified; following the link twice is harmless
+	if !user.EmailVerified {
+		if err := ac.db.MarkEmailVerified(ctx, user.ID); err != nil {
+			log.Printf("Failed to mark email verified: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		ac.audit(c, user.ID, AuditEmailVerified, nil)
+	}
+
+	ac.redirectWithOutcome(c, "email_verified", true)
+}
+
+// ResendVerificationEmail mails a fresh verification link. It answers the
+// same way whether or not the address belongs to an unverified account, so it
+// cannot be used to find out who is registered.
+func (ac *AuthController) ResendVerificationEmail(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, err := ac.db.FindUserByEmail(c.Request.Context(), req.Email)
+	if err == nil && !user.EmailVerified {
+		if err := ac.sendVerificationEmail(c.Request.Context(), user); err != nil {
+			log.Printf("Failed to resend verification email: %v", err)
+		}
+	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("DATABASE ERROR in FindUserByEmail during verification resend: %v", err)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the address belongs to an unverified account, a new verification link is on its way",
+	})
+}
+
+// sendVerificationEmail mails a verification link unless one went out within
+// the resend cooldown, in which case it silently does nothing.
+func (ac *AuthController) sendVerificationEmail(ctx context.Context, user generated.User) error {
+	cfg := ac.cfg.EmailVerification
+
+	claimed, err := ac.db.ClaimVerificationEmailSlot(ctx, generated.ClaimVerificationEmailSlotParams{
+		ID:              user.ID,
+		CooldownSeconds: int32(cfg.ResendCooldown.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		return nil
+	}
+
+	token, err := jwt.GenerateEmailVerificationToken(user.ID, user.Email, cfg.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(cfg.URL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	ac.notify(user.Email, "Verify your email address",
+		fmt.Sprintf("Please confirm that this is your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.",
+			link.String(), cfg.TokenTTL))
+	return nil
+}
+
+// redirectWithOutcome sends the browser back to the frontend with the outcome
+// of a mailed link in the given query parameter
+func (ac *AuthController) redirectWithOutcome(c *gin.Context, param string, ok bool) {
+	redirect, err := url.Parse(ac.cfg.FrontendURL)
+	if err != nil {
+		log.Println("Invalid frontend URL:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	query := redirect.Query()
+	query.Set(param, fmt.Sprint(ok))
+	redirect.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusSeeOther, redirect.String())
+}
+
+// loginBlocked reports whether the verification policy keeps the user out
+func (ac *AuthController) loginBlocked(user generated.User) bool {
+	return !user.EmailVerified && ac.cfg.EmailVerification.Policy == config.UnverifiedDeny
+}
+
+// respondEmailUnverified refuses a login under the deny policy. It is only
+// ever sent after the user has proven who they are.
+func respondEmailUnverified(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      "Verify your email address before logging in",
+		"error_code": "email_unverified",
+	})
+}
+
+// generateAccessToken issues a full access token with the user's current
+// roles and scopes, or a restricted one, which carries neither, while the
+// policy restricts unverified accounts.
+func (ac *AuthController) generateAccessToken(ctx context.Context, user generated.User, sessionID pgtype.UUID) (string, error) {
+	if !user.EmailVerified && ac.cfg.EmailVerification.Policy != config.UnverifiedAllow {
+		return jwt.GenerateRestrictedAccessToken(user.ID, user.Email, sessionID)
+	}
+
+	roles, err := ac.db.GetUserRoleNames(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("load roles: %w", err)
+	}
+	scopes, err := ac.db.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("load permissions: %w", err)
+	}
+	return jwt.GenerateAccessToken(user.ID, user.Email, sessionID, jwt.Authorization{Roles: roles, Scopes: scopes})
+}
@@ -29,8 +29,9 @@ func (ac *AuthController) GetMe(c *gin.Context) {
 	// 3. Return the combined object
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
-			"id":    data.UserID,
-			"email": data.Email,
+			"id":             data.UserID,
+			"email":          data.Email,
+			"email_verified": data.EmailVerified,
 		},
 		"device": gin.H{
 			"name":      data.DeviceName.String,
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+
+	generated "auth-service/src/db/generated"
+	jwt "auth-service/src/utils"
+)
+
+type IntrospectRequest struct {
+	Token         string `form:"token" json:"token" binding:"required"`
+	TokenTypeHint string `form:"token_type_hint" json:"token_type_hint"`
+
+	// Audience names the calling service; tokens not issued for it are
+	// reported as inactive.
+	Audience string `form:"audience" json:"audience" binding:"required"`
+}
+
+// IntrospectResponse follows RFC 7662; email, roles, sid, token_use and
+// restricted are extensions for our own services.
+type IntrospectResponse struct {
+	Active    bool     `json:"active"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	TokenID   string   `json:"jti,omitempty"`
+	TokenUse  string   `json:"token_use,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+
+	// Restricted tokens belong to users who have not verified their email.
+	// They carry no roles or scope.
+	Restricted bool `json:"restricted,omitempty"`
+}
+
+// Introspect lets downstream services ask whether a token is still good.
+// Besides the signature and expiry it checks that the session behind the
+// token has not been revoked, which a service validating the JWT locally
+// cannot see. Only unrestricted access tokens are ever active for other
+// services; refresh and restricted tokens are for the auth service itself.
+func (ac *AuthController) Introspect(c *gin.Context) {
+	var req IntrospectRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	inactive := IntrospectResponse{Active: false}
+
+	// 1. Signature, expiry and audience
+	claims, err := jwt.ValidateToken(req.Token, req.Audience)
+	if err != nil || !claims.SessionID.Valid {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+	if (claims.Restricted || claims.Type != "access") && req.Audience != jwt.AudienceAuth {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 2. The backing session must still exist and not be revoked
+	session, err := ac.db.GetActiveSession(ctx, generated.GetActiveSessionParams{
+		ID:     claims.SessionID,
+		UserID: claims.UserID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetActiveSession during introspection: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	// A refresh token that has been rotated out, by its owner or by whoever
+	// stole it, is spent even though its session lives on
+	if claims.Type == "refresh" && session.RefreshTokenHash != hashedToken(req.Token) {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+
+	resp := IntrospectResponse{
+		Active:     true,
+		Subject:    claims.UserID.String(),
+		Audience:   claims.Audience,
+		Email:      claims.Email,
+		Issuer:     claims.Issuer,
+		TokenID:    claims.ID,
+		TokenUse:   claims.Type,
+		SessionID:  claims.SessionID.String(),
+		Restricted: claims.Restricted,
+	}
+
+	// 3. Current roles and scopes, which may be newer than the token's
+	if !claims.Restricted {
+		roles, err := ac.db.GetUserRoleNames(ctx, claims.UserID)
+		if err != nil {
+			log.Printf("DATABASE ERROR in GetUserRoleNames during introspection: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		scopes, err := ac.db.GetUserPermissions(ctx, claims.UserID)
+		if err != nil {
+			log.Printf("DATABASE ERROR in GetUserPermissions during introspection: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+		resp.Roles = roles
+		resp.Scope = strings.Join(scopes, " ")
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		resp.NotBefore = claims.NotBefore.Unix()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
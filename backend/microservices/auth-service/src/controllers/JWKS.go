@@ -0,0 +1,17 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	jwt "auth-service/src/utils"
+)
+
+// JWKSHandler publishes the public signing keys so other services can verify
+// our tokens without ever holding a private key. Verifiers may cache the set
+// briefly; upcoming keys are published well before they start signing.
+func JWKSHandler(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwt.JWKS())
+}
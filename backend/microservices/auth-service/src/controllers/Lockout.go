@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	jwt "auth-service/src/utils"
+)
+
+// UnlockAccount handles the link mailed when an account locks and sends the
+// browser on to the frontend with ?account_unlocked=true or false.
+func (ac *AuthController) UnlockAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. The token must be a valid, unexpired unlock token
+	claims, err := jwt.ValidateToken(c.Query("token"), jwt.AudienceAuth)
+	if err != nil || claims.Type != jwt.TokenTypeAccountUnlock {
+		ac.redirectWithOutcome(c, "account_unlocked", false)
+		return
+	}
+
+	// 2. ...for the address the account still has
+	user, err := ac.db.GetUserByID(ctx, claims.UserID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && user.Email != claims.Email) {
+		ac.redirectWithOutcome(c, "account_unlocked", false)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load user during account unlock: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 3. Lift the lock the link was sent for. Issue times are whole seconds,
+	// so allow for the lock having started within the same second.
+	unlocked, err := ac.lockout.Unlock(ctx, user.Email, claims.IssuedAt.Add(time.Second))
+	if err != nil {
+		log.Printf("Failed to unlock account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if unlocked {
+		ac.audit(c, user.ID, AuditAccountUnlocked, gin.H{"source": "email"})
+	}
+
+	ac.redirectWithOutcome(c, "account_unlocked", unlocked)
+}
+
+// checkLoginThrottle answers 429 while the email address or the client is
+// blocked, and returns false then. The answer is the same for registered and
+// unknown addresses.
+func (ac *AuthController) checkLoginThrottle(c *gin.Context, email string) bool {
+	retryAfter, err := ac.lockout.Check(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		// The password check still runs; only the throttling is skipped
+		log.Printf("Failed to check login throttle: %v", err)
+		return true
+	}
+	if retryAfter <= 0 {
+		return true
+	}
+
+	seconds := int(retryAfter.Seconds())
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Try again later or reset your password.",
+		"error_code":  "too_many_attempts",
+		"retry_after": seconds,
+	})
+	return false
+}
+
+// recordLoginFailure counts a failed login. When it locks a registered
+// account, the owner is told and sent a link to unlock it.
+func (ac *AuthController) recordLoginFailure(c *gin.Context, email string, user generated.User, found bool) {
+	locked, err := ac.lockout.Fail(c.Request.Context(), email, c.ClientIP())
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+		return
+	}
+	if !locked || !found {
+		return
+	}
+
+	ac.audit(c, user.ID, AuditAccountLocked, nil)
+	if err := ac.sendUnlockEmail(user); err != nil {
+		log.Printf("Failed to send unlock email: %v", err)
+	}
+}
+
+// purgeLoginThrottles drops counters old enough to start over anyway
+func (ac *AuthController) purgeLoginThrottles(ctx context.Context) error {
+	window := max(ac.cfg.Lockout.Account.Window, ac.cfg.Lockout.IP.Window)
+	_, err := ac.db.DeleteStaleLoginThrottles(ctx, pgtype.Timestamp{Time: time.Now().Add(-window), Valid: true})
+	return err
+}
+
+func (ac *AuthController) sendUnlockEmail(user generated.User) error {
+	cfg := ac.cfg.Lockout
+
+	token, err := jwt.GenerateAccountUnlockToken(user.ID, user.Email, cfg.UnlockTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(cfg.UnlockURL)
+	if err != nil {
+		return err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	ac.notify(user.Email, "Sign-in to your account was locked",
+		fmt.Sprintf("After %d failed sign-in attempts we have blocked sign-in to your account for %s.\n\n"+
+			"If that was you, you can unlock it straight away with the link below:\n\n%s\n\n"+
+			"If it was not you, someone may be trying to guess your password. Consider changing it "+
+			"and turning on two-factor authentication.",
+			cfg.Account.Threshold, cfg.Account.LockDuration, link.String()))
+	return nil
+}
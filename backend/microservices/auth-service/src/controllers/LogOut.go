@@ -1,36 +1,103 @@
 package auth
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/middleware"
+	jwt "auth-service/src/utils"
 )
 
-// LogoutHandler clears the authentication cookie
-func LogoutHandler(c *gin.Context) {
-	// Clear access token
-	c.SetCookie(
-		"access_token",
-		"",
-		-1,
-		"/",
-		"",
-		false,
-		true,
-	)
-
-	// Clear refresh token
-	c.SetCookie(
-		"refresh_token",
-		"",
-		-1,
-		"/",
-		"",
-		false,
-		true,
-	)
+// Logout revokes the caller's current session and clears the auth cookies
+func (ac *AuthController) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var revoked int64
+	if claims := ac.currentSession(c); claims != nil {
+		n, err := ac.db.RevokeSession(ctx, generated.RevokeSessionParams{
+			ID:     claims.SessionID,
+			UserID: claims.UserID,
+		})
+		if err != nil {
+			log.Printf("Failed to revoke session during logout: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+		revoked = n
+	}
+
+	ac.clearAuthCookies(c)
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Logged out successfully",
+		"message":          "Logged out successfully",
+		"revoked_sessions": revoked,
 	})
 }
+
+// LogoutAll revokes every session of the authenticated user
+func (ac *AuthController) LogoutAll(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+
+	revoked, err := ac.db.RevokeUserSessions(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to revoke sessions during logout/all: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	ac.clearAuthCookies(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Logged out of all sessions",
+		"revoked_sessions": revoked,
+	})
+}
+
+// currentSession resolves the session the caller is logged in with. A bearer
+// token takes precedence, as in AuthMiddleware; otherwise the refresh cookie
+// is preferred over the access cookie. It returns nil when nothing identifies
+// a session.
+func (ac *AuthController) currentSession(c *gin.Context) *jwt.Claims {
+	var candidates []string
+	tokenString, err := middleware.BearerToken(c.Request)
+	if err == nil {
+		candidates = append(candidates, tokenString)
+	} else if errors.Is(err, middleware.ErrNoBearerToken) {
+		for _, name := range []string{"refresh_token", "access_token"} {
+			if tokenString, err := c.Cookie(name); err == nil && tokenString != "" {
+				candidates = append(candidates, tokenString)
+			}
+		}
+	}
+
+	for _, tokenString := range candidates {
+		claims, err := jwt.ValidateToken(tokenString, jwt.AudienceAuth)
+		if err != nil {
+			continue
+		}
+
+		if claims.SessionID.Valid {
+			return claims
+		}
+
+		// Refresh tokens minted before sid was added are found by their hash
+		if claims.Type == "refresh" {
+			session, err := ac.db.GetSessionByRefreshTokenHash(c.Request.Context(), hashedToken(tokenString))
+			if err == nil {
+				claims.SessionID = session.ID
+				return claims
+			}
+		}
+	}
+	return nil
+}
@@ -1,7 +1,7 @@
 package auth
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,10 +9,12 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
-	"golang.org/x/crypto/bcrypt"
 
 	generated "auth-service/src/db/generated"
+	"auth-service/src/security"
 	jwt "auth-service/src/utils"
 
 	ua "github.com/mssola/user_agent"
@@ -26,10 +28,11 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	ID        pgtype.UUID      `json:"id"`
-	Email     string           `json:"email"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
-	Device    DeviceResponse   `json:"device"`
+	ID            pgtype.UUID      `json:"id"`
+	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
+	CreatedAt     pgtype.Timestamp `json:"created_at"`
+	Device        DeviceResponse   `json:"device"`
 }
 type DeviceResponse struct {
 	Name     string    `json:"name"`
@@ -44,53 +47,105 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
+	inBody, err := tokensInBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx := c.Request.Context()
 
-	// 1. Find user by email
-	user, err := ac.db.FindUserByEmail(ctx, req.Email)
-	if err == sql.ErrNoRows {
-		// Don't reveal if email exists or not (security best practice)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// 1. Refuse straight away while the address or the client is backing off
+	if !ac.checkLoginThrottle(c, req.Email) {
 		return
 	}
-	if err != nil {
+
+	// 2. Find user by email
+	user, err := ac.db.FindUserByEmail(ctx, req.Email)
+	found := err == nil
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		log.Printf("DATABASE ERROR in FindUserByEmail during login: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
 		return
 	}
 
-	// 2. Verify password
-	if !user.PasswordHash.Valid || user.PasswordHash.String == "" {
+	// 3. Verify password. Unknown addresses and accounts without a password
+	// cost a hash too and fail the same way, so neither the response nor its
+	// timing reveals whether the email is registered.
+	var match, rehash bool
+	if found && user.PasswordHash.Valid && user.PasswordHash.String != "" {
+		match, rehash = ac.passwordMatches(user, req.Password)
+	} else {
+		ac.hasher.VerifyDummy(req.Password)
+	}
+	if !match {
+		ac.recordLoginFailure(c, req.Email, user, found)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	// With MFA on, failures are only cleared once the code is right too, or
+	// someone who knows the password could reset the count between guesses
+	if !user.MfaEnabled.Bool {
+		if err := ac.lockout.Succeed(ctx, req.Email); err != nil {
+			log.Printf("Failed to clear login failures: %v", err)
+		}
+	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash.String), []byte(req.Password))
-	if err != nil {
-		// Wrong password
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	// Upgrade hashes made with an older algorithm or cost while we have the
+	// plaintext; failing to do so never fails the login
+	if rehash {
+		ac.rehashPassword(c, user, req.Password)
+	}
+
+	// 4. Unverified accounts may be kept out entirely
+	if ac.loginBlocked(user) {
+		respondEmailUnverified(c)
 		return
 	}
 
-	// 3. Generate tokens
-	accessToken, err := jwt.GenerateAccessToken(user.ID, user.Email)
+	// 5. With MFA on, the password only earns a second-factor challenge
+	if user.MfaEnabled.Bool {
+		ac.startMfaChallenge(c, user)
+		return
+	}
+
+	ac.finishLogin(c, user, inBody)
+}
+
+// finishLogin opens a session for a fully authenticated user: it issues the
+// token pair, records the device and responds the way Login always has.
+// Every login path (password, second factor, passkey) ends here.
+func (ac *AuthController) finishLogin(c *gin.Context, user generated.User, inBody bool) {
+	ctx := c.Request.Context()
+
+	if ac.loginBlocked(user) {
+		respondEmailUnverified(c)
+		return
+	}
+	ac.cancelPendingDeletion(c, user)
+
+	// 1. Generate tokens bound to a new session
+	sessionID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	accessToken, err := ac.generateAccessToken(ctx, user, sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
 		return
 	}
 
-	refreshToken, err := jwt.GenerateRefreshToken(user.ID, user.Email)
+	refreshToken, err := jwt.GenerateRefreshToken(user.ID, user.Email, sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
 		return
 	}
 
-	// 4. Store refresh token in sessions table
+	// 2. Store refresh token in sessions table
 	expiresAt := time.Now().Add(7 * 24 * time.Hour)
 	_, err = ac.db.CreateSession(ctx, generated.CreateSessionParams{
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		ExpiresAt:    pgtype.Timestamp{Time: expiresAt, Valid: true},
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: pgtype.Text{String: security.HashToken(refreshToken), Valid: true},
+		ExpiresAt:        pgtype.Timestamp{Time: expiresAt, Valid: true},
 	})
 	if err != nil {
 		log.Printf("Failed to store session during login: %v", err)
@@ -98,7 +153,7 @@ func (ac *AuthController) Login(c *gin.Context) {
 		return
 	}
 
-	// 5. Register/update current device (same as register)
+	// 3. Register/update current device (same as register)
 	clientIP := c.ClientIP()
 	rawUserAgent := c.Request.UserAgent()
 
@@ -145,16 +200,18 @@ func (ac *AuthController) Login(c *gin.Context) {
 		IpAddress: pgtype.Text{String: clientIP, Valid: true},
 	})
 
-	if err != nil && err != sql.ErrNoRows {
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		log.Printf("Error checking existing device: %v", err)
 		// non-critical, continue
 	}
 
 	var finalDeviceName string = deviceName
 	var finalDeviceType string = deviceType
+	var deviceID pgtype.UUID
 
 	if err == nil && existingDevice.Valid {
 		// Update existing device
+		deviceID = existingDevice
 		err = ac.db.UpdateDeviceLastSeen(ctx, generated.UpdateDeviceLastSeenParams{
 			ID:       existingDevice,
 			LastSeen: pgtype.Timestamp{Time: time.Now(), Valid: true},
@@ -166,7 +223,7 @@ func (ac *AuthController) Login(c *gin.Context) {
 
 	} else {
 		// Create new device
-		_, err = ac.db.CreateDevice(ctx, generated.CreateDeviceParams{
+		device, err := ac.db.CreateDevice(ctx, generated.CreateDeviceParams{
 			UserID:     user.ID,
 			DeviceName: pgtype.Text{String: deviceName, Valid: true},
 			DeviceType: pgtype.Text{String: deviceType, Valid: true},
@@ -177,23 +234,35 @@ func (ac *AuthController) Login(c *gin.Context) {
 			log.Printf("Failed to create device during login: %v", err)
 			// non-critical
 		}
+		deviceID = device.ID
 	}
 
-	// 6. Set cookies and respond
-	c.SetSameSite(http.SameSiteStrictMode)
-	c.SetCookie("access_token", accessToken, 15*60, "/", "", false, true)        // 15 minutes
-	c.SetCookie("refresh_token", refreshToken, 7*24*60*60, "/", "", false, true) // 7 days
+	// Link the session to the device so /sessions can show where it lives
+	if deviceID.Valid {
+		err = ac.db.AttachSessionDevice(ctx, generated.AttachSessionDeviceParams{
+			ID:       sessionID,
+			DeviceID: deviceID,
+		})
+		if err != nil {
+			log.Printf("Failed to link session to device during login: %v", err)
+		}
+	}
 
-	c.JSON(http.StatusOK, gin.H{
+	// 4. Hand out the tokens and respond
+	resp := gin.H{
 		"message": "Logged in successfully",
 		"user": LoginResponse{
-			ID:        user.ID,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt, Device: DeviceResponse{
+			ID:            user.ID,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			CreatedAt:     user.CreatedAt, Device: DeviceResponse{
 				Name:     finalDeviceName,
 				Type:     finalDeviceType,
 				LastSeen: time.Now(), // We just updated/created it
 			},
 		},
-	})
+	}
+	ac.deliverTokens(c, resp, inBody, accessToken, refreshToken, ac.cfg.Cookie.SameSiteMode())
+
+	c.JSON(http.StatusOK, resp)
 }
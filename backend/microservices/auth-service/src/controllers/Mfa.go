@@ -0,0 +1,703 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/security"
+)
+
+const (
+	totpPeriod = 30
+	totpSkew   = 1 // accept one step either side for clock drift
+
+	mfaChallengeTTL    = 5 * time.Minute
+	maxMfaAttempts     = 5
+	mfaChallengeCookie = "mfa_token"
+
+	// recentLoginWindow is how fresh the session must be for an account that
+	// has neither a password nor MFA to confirm a sensitive action
+	recentLoginWindow = 10 * time.Minute
+
+	recoveryCodeCount    = 10
+	recoveryCodeLength   = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789" // no 0/o, 1/l/i
+)
+
+// Second-factor methods accepted by POST /login/mfa
+const (
+	mfaMethodTotp         = "totp"
+	mfaMethodRecoveryCode = "recovery_code"
+)
+
+// errMfaAlreadyEnabled rolls back a confirmation that lost the race to another one
+var errMfaAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+type TotpCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ReauthRequest re-authenticates a sensitive action. Code is a current TOTP
+// code or a recovery code.
+type ReauthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type LoginMfaRequest struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// EnrollTotp starts TOTP enrollment. The secret is stored encrypted but stays
+// inactive until ConfirmTotp sees a first valid code, so a user who abandons
+// enrollment halfway is not locked out. Enrolling again replaces a pending secret.
+func (ac *AuthController) EnrollTotp(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	// 1. Only users without an active authenticator can enroll
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user during TOTP enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if user.MfaEnabled.Bool {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	// 2. Generate the secret
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      ac.cfg.MFA.Issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      otp.DigitsSix,
+		Algorithm:   otp.AlgorithmSHA1,
+	})
+	if err != nil {
+		log.Printf("Failed to generate TOTP secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	// 3. Store it encrypted and bound to the user
+	encrypted, err := security.EncryptSecret([]byte(key.Secret()), user.ID.Bytes[:])
+	if err != nil {
+		log.Printf("Failed to encrypt TOTP secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+		return
+	}
+
+	stored, err := ac.db.UpsertPendingTotp(ctx, generated.UpsertPendingTotpParams{
+		UserID:          user.ID,
+		SecretEncrypted: encrypted,
+	})
+	if err != nil {
+		log.Printf("Failed to store TOTP secret: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+		return
+	}
+	if stored == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	// 4. Return everything an authenticator app needs
+	qrCode, err := qrCodeDataURI(key)
+	if err != nil {
+		log.Printf("Failed to render TOTP QR code: %v", err)
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      key.Secret(),
+		"otpauth_uri": key.URL(),
+		"qr_code":     qrCode,
+	})
+}
+
+// ConfirmTotp activates a pending enrollment once the user proves their
+// authenticator produces valid codes.
+func (ac *AuthController) ConfirmTotp(c *gin.Context) {
+	var req TotpCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	// 1. Load the pending secret
+	record, err := ac.db.GetTotpByUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending TOTP enrollment"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load TOTP secret during confirmation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if record.ConfirmedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := security.DecryptSecret(record.SecretEncrypted, userID.Bytes[:])
+	if err != nil {
+		log.Printf("Failed to decrypt TOTP secret for user %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 2. Check the first code
+	step, ok := matchTotpStep(string(secret), req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	// 3. Activate and create the recovery codes together. The step is recorded
+	// so the same code cannot log in afterwards.
+	var codes []string
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		confirmed, err := q.ConfirmTotp(ctx, generated.ConfirmTotpParams{
+			UserID:       userID,
+			LastUsedStep: pgtype.Int8{Int64: step, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if confirmed == 0 {
+			return errMfaAlreadyEnabled
+		}
+
+		err = q.SetUserMfaEnabled(ctx, generated.SetUserMfaEnabledParams{
+			ID:         userID,
+			MfaEnabled: pgtype.Bool{Bool: true, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(ctx, q, userID)
+		return err
+	})
+	if errors.Is(err, errMfaAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to confirm TOTP enrollment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	ac.audit(c, userID, AuditMfaEnabled, gin.H{"method": mfaMethodTotp})
+
+	// 4. Hand out recovery codes. This is the only time they are shown.
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after re-authentication.
+// Codes from the previous set stop working immediately.
+func (ac *AuthController) RegenerateRecoveryCodes(c *gin.Context) {
+	var req ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	// 1. Load the user
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user while regenerating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if !user.MfaEnabled.Bool {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	// 2. Re-authenticate
+	ok, err := ac.reauthenticate(c, user, req.Password, req.Code)
+	if err != nil {
+		log.Printf("Re-authentication error while regenerating recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Re-authentication failed"})
+		return
+	}
+
+	// 3. Replace the codes
+	codes, err := replaceRecoveryCodes(ctx, ac.db, userID)
+	if err != nil {
+		log.Printf("Failed to regenerate recovery codes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	ac.audit(c, userID, AuditRecoveryCodesRegenerated, nil)
+	ac.notify(user.Email, "Your recovery codes were regenerated",
+		"New two-factor recovery codes were generated for your account and the previous codes no longer work.\n\n"+
+			"If you did not do this, reset your password and review your active sessions immediately.")
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Recovery codes regenerated",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMfa removes the authenticator. A stolen session alone is not enough:
+// the caller re-authenticates with their password (if they have one) and a
+// current code.
+func (ac *AuthController) DisableMfa(c *gin.Context) {
+	var req ReauthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	// 1. Load the user
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user while disabling MFA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if !user.MfaEnabled.Bool {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	// 2. Re-authenticate
+	ok, err := ac.reauthenticate(c, user, req.Password, req.Code)
+	if err != nil {
+		log.Printf("Re-authentication error while disabling MFA: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Re-authentication failed"})
+		return
+	}
+
+	// 3. Remove the authenticator and its recovery codes
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		if err := q.DeleteTotp(ctx, userID); err != nil {
+			return err
+		}
+		if err := q.DeleteRecoveryCodes(ctx, userID); err != nil {
+			return err
+		}
+		return q.SetUserMfaEnabled(ctx, generated.SetUserMfaEnabledParams{
+			ID:         userID,
+			MfaEnabled: pgtype.Bool{Bool: false, Valid: true},
+		})
+	})
+	if err != nil {
+		log.Printf("Failed to disable MFA for user %v: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	ac.audit(c, userID, AuditMfaDisabled, nil)
+	ac.notify(user.Email, "Two-factor authentication was turned off",
+		"Two-factor authentication was disabled on your account.\n\n"+
+			"If you did not do this, reset your password and review your active sessions immediately.")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginMfa completes a login that Login (or the Google callback) answered
+// with an mfa_required challenge, using a TOTP code or a recovery code. The
+// challenge token comes from the body or, after a Google redirect, from the
+// mfa_token cookie.
+func (ac *AuthController) LoginMfa(c *gin.Context) {
+	var req LoginMfaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	inBody, err := tokensInBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	challengeToken := req.MfaToken
+	if challengeToken == "" {
+		challengeToken, _ = c.Cookie(mfaChallengeCookie)
+	}
+	if challengeToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA token required"})
+		return
+	}
+
+	// 1. Find the pending challenge
+	challenge, err := ac.db.GetMfaChallengeByTokenHash(ctx, security.HashToken(challengeToken))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge"})
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetMfaChallengeByTokenHash: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	user, err := ac.db.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		log.Printf("Failed to load user during MFA login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 2. Wrong codes count towards the same lockout as wrong passwords, so
+	// opening fresh challenges does not buy more guesses
+	if !ac.checkLoginThrottle(c, user.Email) {
+		return
+	}
+
+	// 3. Check the code; a challenge survives only a few wrong guesses
+	ok, err := ac.verifySecondFactor(c, user, req.Code)
+	if err != nil {
+		log.Printf("Failed to verify second factor: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if !ok {
+		ac.recordLoginFailure(c, user.Email, user, true)
+		attempts, err := ac.db.IncrementMfaChallengeAttempts(ctx, challenge.ID)
+		if err != nil {
+			log.Printf("Failed to count MFA attempt: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		if attempts >= maxMfaAttempts {
+			if _, err := ac.db.ConsumeMfaChallenge(ctx, challenge.ID); err != nil {
+				log.Printf("Failed to consume MFA challenge: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many invalid codes, please log in again"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	// 4. Burn the challenge; a concurrent request with the same token loses
+	consumed, err := ac.db.ConsumeMfaChallenge(ctx, challenge.ID)
+	if err != nil {
+		log.Printf("Failed to consume MFA challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if consumed == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA challenge"})
+		return
+	}
+
+	if err := ac.lockout.Succeed(ctx, user.Email); err != nil {
+		log.Printf("Failed to clear login failures: %v", err)
+	}
+
+	// 5. Log in
+	c.SetCookie(mfaChallengeCookie, "", -1, "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
+	ac.finishLogin(c, user, inBody)
+}
+
+// startMfaChallenge answers a correct password with a challenge instead of tokens
+func (ac *AuthController) startMfaChallenge(c *gin.Context, user generated.User) {
+	token, err := ac.createMfaChallenge(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("Failed to create MFA challenge: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Second factor required",
+		"mfa_required": true,
+		"mfa_token":    token,
+		"methods":      []string{mfaMethodTotp, mfaMethodRecoveryCode},
+		"expires_in":   int(mfaChallengeTTL.Seconds()),
+	})
+}
+
+// createMfaChallenge stores a new challenge and returns its token
+func (ac *AuthController) createMfaChallenge(ctx context.Context, userID pgtype.UUID) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	_, err := ac.db.CreateMfaChallenge(ctx, generated.CreateMfaChallengeParams{
+		UserID:    userID,
+		TokenHash: security.HashToken(token),
+		ExpiresAt: pgtype.Timestamp{Time: time.Now().Add(mfaChallengeTTL), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// reauthenticate confirms a sensitive action: the password when the account
+// has one, and a second-factor code when MFA is enabled.
+func (ac *AuthController) reauthenticate(c *gin.Context, user generated.User, password, code string) (bool, error) {
+	hasPassword := user.PasswordHash.Valid && user.PasswordHash.String != ""
+	if hasPassword {
+		if match, _ := ac.passwordMatches(user, password); !match {
+			return false, nil
+		}
+	}
+
+	if user.MfaEnabled.Bool {
+		return ac.verifySecondFactor(c, user, code)
+	}
+	return hasPassword, nil
+}
+
+// confirmIdentity re-authenticates a sensitive action and answers the request
+// itself when that fails. An OAuth-only account without MFA has nothing to
+// re-enter, so its session must have started within the last few minutes
+// instead. action completes "Sign in again to ..." in the error.
+func (ac *AuthController) confirmIdentity(c *gin.Context, user generated.User, password, code, action string) bool {
+	if (user.PasswordHash.Valid && user.PasswordHash.String != "") || user.MfaEnabled.Bool {
+		ok, err := ac.reauthenticate(c, user, password, code)
+		if err != nil {
+			log.Printf("Re-authentication error for user %v: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return false
+		}
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Re-authentication failed"})
+		}
+		return ok
+	}
+
+	currentSessionID, _ := c.Get("session_id")
+	sessionID, _ := currentSessionID.(pgtype.UUID)
+	session, err := ac.db.GetActiveSession(c.Request.Context(), generated.GetActiveSessionParams{ID: sessionID, UserID: user.ID})
+	if err != nil || time.Since(session.CreatedAt.Time) > recentLoginWindow {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":      "Sign in again to " + action,
+			"error_code": "reauthentication_required",
+		})
+		return false
+	}
+	return true
+}
+
+// verifySecondFactor accepts a TOTP code or, failing that, an unused recovery
+// code. Spending a recovery code is audited and the user is told about it,
+// since it is also what an attacker holding a stolen code would do.
+func (ac *AuthController) verifySecondFactor(c *gin.Context, user generated.User, code string) (bool, error) {
+	ctx := c.Request.Context()
+
+	ok, err := ac.verifyTotp(ctx, user.ID, code)
+	if err != nil || ok {
+		return ok, err
+	}
+
+	used, err := ac.db.UseRecoveryCode(ctx, generated.UseRecoveryCodeParams{
+		UserID:   user.ID,
+		CodeHash: security.HashToken(normalizeRecoveryCode(code)),
+	})
+	if err != nil {
+		return false, err
+	}
+	if used == 0 {
+		return false, nil
+	}
+
+	remaining, err := ac.db.CountUnusedRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		log.Printf("Failed to count recovery codes: %v", err)
+	}
+
+	ac.audit(c, user.ID, AuditRecoveryCodeUsed, gin.H{"remaining": remaining})
+	ac.notify(user.Email, "A recovery code was used on your account",
+		fmt.Sprintf("A two-factor recovery code was just used to sign in to your account from %s. "+
+			"You have %d unused recovery codes left.\n\n"+
+			"If this was not you, reset your password and regenerate your recovery codes immediately.",
+			c.ClientIP(), remaining))
+
+	return true, nil
+}
+
+// replaceRecoveryCodes generates a fresh set of recovery codes, stores their
+// hashes in place of the old set and returns the plaintext codes.
+func replaceRecoveryCodes(ctx context.Context, q *generated.Queries, userID pgtype.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = security.HashToken(normalizeRecoveryCode(code))
+	}
+
+	err := q.ReplaceRecoveryCodes(ctx, generated.ReplaceRecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k7mfq-2xw9h"
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+	half := recoveryCodeLength / 2
+	return string(b[:half]) + "-" + string(b[half:]), nil
+}
+
+// normalizeRecoveryCode makes input forgiving about case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// verifyTotp checks a code against the user's confirmed authenticator. Each
+// time step can be used once, so an observed code cannot be replayed.
+func (ac *AuthController) verifyTotp(ctx context.Context, userID pgtype.UUID, code string) (bool, error) {
+	record, err := ac.db.GetTotpByUser(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !record.ConfirmedAt.Valid {
+		return false, nil
+	}
+
+	secret, err := security.DecryptSecret(record.SecretEncrypted, userID.Bytes[:])
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := matchTotpStep(string(secret), code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	recorded, err := ac.db.RecordTotpStep(ctx, generated.RecordTotpStepParams{
+		Step:   pgtype.Int8{Int64: step, Valid: true},
+		UserID: userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return recorded == 1, nil
+}
+
+// matchTotpStep returns the time step a code belongs to, allowing for clock skew
+func matchTotpStep(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	opts := totp.ValidateOpts{
+		Period:    totpPeriod,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// qrCodeDataURI renders the otpauth URI as a PNG data URI for the frontend
+func qrCodeDataURI(key *otp.Key) (string, error) {
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
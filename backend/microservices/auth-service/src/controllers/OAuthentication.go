@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	ua "github.com/mssola/user_agent"
@@ -20,14 +22,14 @@ import (
 
 	"auth-service/src/config"
 	generated "auth-service/src/db/generated"
+	"auth-service/src/security"
 	jwt "auth-service/src/utils"
 )
 
 var googleOauthConfig *oauth2.Config
 
 // Initialize once at startup
-func InitGoogleOAuth() {
-	cfg := config.LoadGoogleConfig()
+func InitGoogleOAuth(cfg config.GoogleConfig) {
 	googleOauthConfig = &oauth2.Config{
 		RedirectURL:  cfg.RedirectURL,
 		ClientID:     cfg.ClientID,
@@ -50,7 +52,7 @@ func (ac *AuthController) GoogleLogin(c *gin.Context) {
 	state := randToken()
 	log.Println("[GoogleLogin] Generated state:", state)
 
-	c.SetCookie("oauth_state", state, 3600, "/", "", false, true)
+	c.SetCookie("oauth_state", state, 3600, "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
 
 	url := googleOauthConfig.AuthCodeURL(state)
 	log.Println("[GoogleLogin] Redirecting to Google OAuth URL:", url)
@@ -83,7 +85,7 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 	}
 
 	log.Println("[GoogleCallback] State validated")
-	c.SetCookie("oauth_state", "", -1, "/", "", false, true)
+	c.SetCookie("oauth_state", "", -1, "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
 
 	// 2. AUTHORIZATION CODE
 	code := c.Query("code")
@@ -153,6 +155,7 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 			OauthProvider:   pgtype.Text{String: "google", Valid: true},
 			OauthProviderID: pgtype.Text{String: googleUser.ID, Valid: true},
 			MfaEnabled:      pgtype.Bool{Bool: false, Valid: true},
+			EmailVerified:   true, // Google has verified it, checked above
 		})
 
 		if err != nil {
@@ -163,40 +166,10 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 
 		log.Println("[GoogleCallback] User created with ID:", user.ID)
 
-		// ROLE ASSIGNMENT – ALSO FIXED FOR pgx
-		var roleID pgtype.UUID
-
-		role, err := ac.db.FindRoleByName(ctx, "user")
-		if errors.Is(err, pgx.ErrNoRows) {
-			// Default role doesn't exist → create it
-			newRole, err := ac.db.CreateRole(ctx, generated.CreateRoleParams{
-				Name:        "user",
-				Description: pgtype.Text{String: "Default user role", Valid: true},
-			})
-			if err != nil {
-				log.Println("[GoogleCallback] Failed to create default role:", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create default role"})
-				return
-			}
-			roleID = newRole.ID
-			log.Println("[GoogleCallback] Default role created with ID:", roleID)
-		} else if err != nil {
-			log.Println("[GoogleCallback] Role lookup failed:", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Role lookup failed"})
-			return
-		} else {
-			roleID = role.ID
-		}
-
-		_, err = ac.db.CreateUserRole(ctx, generated.CreateUserRoleParams{
-			UserID: user.ID,
-			RoleID: roleID,
-		})
-		if err != nil {
+		// ROLE ASSIGNMENT – the role itself is seeded at startup
+		if err := ac.assignDefaultRole(ctx, user.ID); err != nil {
 			log.Println("[GoogleCallback] Failed to assign role:", err)
 			// Not fatal
-		} else {
-			log.Println("[GoogleCallback] Role 'user' assigned successfully")
 		}
 
 	} else if err != nil {
@@ -207,17 +180,58 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 	} else {
 		// User already exists → just log in
 		log.Println("[GoogleCallback] Found existing user:", user.Email)
+
+		// Google vouches for the address, so there is nothing left to verify
+		if !user.EmailVerified && user.Email == googleUser.Email {
+			if err := ac.db.MarkEmailVerified(ctx, user.ID); err != nil {
+				log.Println("[GoogleCallback] Failed to mark email verified:", err)
+			} else {
+				user.EmailVerified = true
+				ac.audit(c, user.ID, AuditEmailVerified, gin.H{"source": "google"})
+			}
+		}
 	}
 
-	// 6. JWT GENERATION
-	accessToken, err := jwt.GenerateAccessToken(user.ID, user.Email)
+	// 6. SECOND FACTOR
+	// The browser goes back to the frontend with a challenge cookie and
+	// finishes the login through POST /login/mfa.
+	if user.MfaEnabled.Bool {
+		mfaToken, err := ac.createMfaChallenge(ctx, user.ID)
+		if err != nil {
+			log.Println("[GoogleCallback] Failed to create MFA challenge:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA challenge"})
+			return
+		}
+
+		redirect, err := url.Parse(ac.cfg.FrontendURL)
+		if err != nil {
+			log.Println("[GoogleCallback] Invalid frontend URL:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+			return
+		}
+		query := redirect.Query()
+		query.Set("mfa_required", "true")
+		redirect.RawQuery = query.Encode()
+
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(mfaChallengeCookie, mfaToken, int(mfaChallengeTTL.Seconds()), "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
+		c.Redirect(http.StatusTemporaryRedirect, redirect.String())
+		return
+	}
+
+	ac.cancelPendingDeletion(c, user)
+
+	// 7. JWT GENERATION
+	sessionID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	accessToken, err := ac.generateAccessToken(ctx, user, sessionID)
 	if err != nil {
 		log.Println("[GoogleCallback] Failed to generate access token:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
 		return
 	}
 
-	refreshToken, err := jwt.GenerateRefreshToken(user.ID, user.Email)
+	refreshToken, err := jwt.GenerateRefreshToken(user.ID, user.Email, sessionID)
 	if err != nil {
 		log.Println("[GoogleCallback] Failed to generate refresh token:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
@@ -226,18 +240,19 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 
 	log.Println("[GoogleCallback] JWTs generated")
 
-	// 7. SESSION STORAGE
+	// 8. SESSION STORAGE
 	expiresAt := time.Now().Add(7 * 24 * time.Hour)
 	_, err = ac.db.CreateSession(ctx, generated.CreateSessionParams{
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		ExpiresAt:    pgtype.Timestamp{Time: expiresAt, Valid: true},
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: pgtype.Text{String: security.HashToken(refreshToken), Valid: true},
+		ExpiresAt:        pgtype.Timestamp{Time: expiresAt, Valid: true},
 	})
 	if err != nil {
 		log.Println("[GoogleCallback] Failed to store session:", err)
 	}
 
-	// 8. DEVICE TRACKING
+	// 9. DEVICE TRACKING
 	clientIP := c.ClientIP()
 	rawUserAgent := c.Request.UserAgent()
 
@@ -260,9 +275,11 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 		IpAddress: pgtype.Text{String: clientIP, Valid: true},
 	})
 
+	var deviceID pgtype.UUID
 	if errors.Is(err, pgx.ErrNoRows) {
 		// No device yet → create one
-		_, err = ac.db.CreateDevice(ctx, generated.CreateDeviceParams{
+		var device generated.Device
+		device, err = ac.db.CreateDevice(ctx, generated.CreateDeviceParams{
 			UserID:     user.ID,
 			DeviceName: pgtype.Text{String: deviceName, Valid: true},
 			DeviceType: pgtype.Text{String: deviceType, Valid: true},
@@ -272,10 +289,12 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 		if err != nil {
 			log.Println("[GoogleCallback] Failed to create device:", err)
 		}
+		deviceID = device.ID
 	} else if err != nil {
 		log.Println("[GoogleCallback] Device lookup failed:", err)
 	} else if existingDevice.Valid {
 		// Update last seen
+		deviceID = existingDevice
 		err = ac.db.UpdateDeviceLastSeen(ctx, generated.UpdateDeviceLastSeenParams{
 			ID:       existingDevice,
 			LastSeen: pgtype.Timestamp{Time: time.Now(), Valid: true},
@@ -285,10 +304,19 @@ func (ac *AuthController) GoogleCallback(c *gin.Context) {
 		}
 	}
 
-	// 9. COOKIES + RESPONSE
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie("access_token", accessToken, 15*60, "/", "", false, true)        // 15 minutes
-	c.SetCookie("refresh_token", refreshToken, 7*24*60*60, "/", "", false, true) // 7 days
+	if deviceID.Valid {
+		err = ac.db.AttachSessionDevice(ctx, generated.AttachSessionDeviceParams{
+			ID:       sessionID,
+			DeviceID: deviceID,
+		})
+		if err != nil {
+			log.Println("[GoogleCallback] Failed to link session to device:", err)
+		}
+	}
+
+	// 10. COOKIES + RESPONSE
+	// Lax so the cookies survive the top-level redirect back from Google
+	ac.setAuthCookies(c, accessToken, refreshToken, http.SameSiteLaxMode)
 
-	c.Redirect(http.StatusTemporaryRedirect, "http://localhost:3002/dashboard")
+	c.Redirect(http.StatusTemporaryRedirect, ac.cfg.FrontendURL)
 }
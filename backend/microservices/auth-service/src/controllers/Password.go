@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/password"
+	"auth-service/src/security"
+)
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ChangePasswordRequest leaves CurrentPassword empty when an OAuth-only
+// account sets its first password. Code is required when MFA is enabled there.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+	Code            string `json:"code"`
+}
+
+// ForgotPassword mails a single-use reset link. The response is the same
+// whether or not the address is registered, so it cannot be used to find
+// out who has an account.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	accepted := gin.H{
+		"message": "If an account exists for that address, we have sent instructions to reset the password",
+	}
+
+	// 1. Find the account
+	user, err := ac.db.FindUserByEmail(ctx, req.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in FindUserByEmail during password reset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 2. Issue a token, unless one went out within the cooldown
+	token, err := ac.issuePasswordResetToken(ctx, ac.db, user.ID, ac.cfg.PasswordReset.ResendCooldown)
+	if err != nil {
+		log.Printf("Failed to issue password reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+	if token == "" {
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	// 3. OAuth-only accounts have no password to reset. They get told how
+	// they sign in instead; the token is recorded for the cooldown but never sent.
+	if !user.PasswordHash.Valid || user.PasswordHash.String == "" {
+		provider := "your identity provider"
+		if user.OauthProvider.String == "google" {
+			provider = "Google"
+		}
+		ac.notify(user.Email, "About your password reset request",
+			fmt.Sprintf("Someone asked to reset the password for your account, but your account does not use a password: "+
+				"you sign in with %s.\n\nIf you would like a password as well, sign in with %s and set one in your account settings. "+
+				"If you did not make this request, you can ignore this email.", provider, provider))
+		c.JSON(http.StatusAccepted, accepted)
+		return
+	}
+
+	// 4. Mail the link
+	link, err := ac.passwordResetLink(token)
+	if err != nil {
+		log.Printf("Invalid password reset URL: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	ac.notify(user.Email, "Reset your password",
+		fmt.Sprintf("Someone asked to reset the password for your account. To choose a new password, open the link below:\n\n%s\n\n"+
+			"The link works once and expires in %s. If you did not make this request, you can ignore this email; "+
+			"your password will not change.", link, ac.cfg.PasswordReset.TokenTTL))
+
+	c.JSON(http.StatusAccepted, accepted)
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword. The
+// token is burned, every other outstanding token for the account stops
+// working and all sessions are revoked, all in one transaction.
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 1. Look the token up without burning it, so a password the policy
+	// rejects does not cost the user their link
+	user, err := ac.db.GetUserByPasswordResetToken(ctx, security.HashToken(req.Token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up password reset token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 2. Check and hash the new password
+	if !ac.checkPasswordPolicy(c, "password", req.Password, user.Email) {
+		return
+	}
+	hash, ok := ac.hashNewPassword(c, req.Password)
+	if !ok {
+		return
+	}
+
+	// 3. Burn the token and apply the new password
+	var revoked int64
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		userID, err := q.ConsumePasswordResetToken(ctx, security.HashToken(req.Token))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		err = q.UpdateUserPassword(ctx, generated.UpdateUserPasswordParams{
+			ID:           userID,
+			PasswordHash: pgtype.Text{String: hash, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.InvalidatePasswordResetTokens(ctx, userID); err != nil {
+			return err
+		}
+
+		// Whoever holds the old password or a stolen session is locked out
+		if revoked, err = q.RevokeUserSessions(ctx, userID); err != nil {
+			return err
+		}
+
+		// The reset link proves the user can read mail sent to the address
+		return q.MarkEmailVerified(ctx, userID)
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reset password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// 4. The reset proves who they are, so a login lockout goes too
+	if err := ac.lockout.Reset(ctx, user.Email); err != nil {
+		log.Printf("Failed to clear login lockout after password reset: %v", err)
+	}
+
+	// 5. Tell the user and respond
+	ac.audit(c, user.ID, AuditPasswordReset, gin.H{"revoked_sessions": revoked})
+	ac.notify(user.Email, "Your password was reset",
+		"The password for your account was just reset and you have been signed out everywhere.\n\n"+
+			"If you did not do this, contact support immediately.")
+
+	ac.clearAuthCookies(c)
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Password has been reset; please log in with your new password",
+		"revoked_sessions": revoked,
+	})
+}
+
+// ChangePassword changes the caller's password after checking the current
+// one, and revokes every other session while keeping the one making the
+// request. An OAuth-only account has no current password and uses this to
+// set its first one, so it can log in both ways; it confirms with a
+// second-factor code or, without MFA, by having signed in just now.
+func (ac *AuthController) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	currentSessionID, _ := c.Get("session_id")
+	keepSessionID, _ := currentSessionID.(pgtype.UUID) // zero for tokens without sid: then all sessions go
+	ctx := c.Request.Context()
+
+	// 1. Load the user
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user during password change: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 2. Prove it is really them: the current password, or for a first
+	// password on an OAuth account, a second-factor code or a fresh login.
+	// Otherwise a stolen access token could turn into a permanent password.
+	firstPassword := !user.PasswordHash.Valid || user.PasswordHash.String == ""
+	if !firstPassword {
+		if match, _ := ac.passwordMatches(user, req.CurrentPassword); !match {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+	} else if !ac.confirmIdentity(c, user, "", req.Code, "set a password") {
+		return
+	}
+
+	// 3. Check and hash the new password
+	if !ac.checkPasswordPolicy(c, "new_password", req.NewPassword, user.Email) {
+		return
+	}
+	hash, ok := ac.hashNewPassword(c, req.NewPassword)
+	if !ok {
+		return
+	}
+
+	// 4. Store it and sign out everywhere else
+	var revoked int64
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		err := q.UpdateUserPassword(ctx, generated.UpdateUserPasswordParams{
+			ID:           userID,
+			PasswordHash: pgtype.Text{String: hash, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		if err := q.InvalidatePasswordResetTokens(ctx, userID); err != nil {
+			return err
+		}
+		revoked, err = q.RevokeOtherUserSessions(ctx, generated.RevokeOtherUserSessionsParams{
+			UserID:        userID,
+			KeepSessionID: keepSessionID,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("Failed to change password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	// 5. Tell the user and respond
+	if firstPassword {
+		ac.audit(c, userID, AuditPasswordSet, gin.H{"revoked_sessions": revoked})
+		ac.notify(user.Email, "A password was added to your account",
+			"A password was just set for your account, so you can now also sign in with your email address and password.\n\n"+
+				"If you did not do this, contact support immediately.")
+	} else {
+		ac.audit(c, userID, AuditPasswordChanged, gin.H{"revoked_sessions": revoked})
+		ac.notify(user.Email, "Your password was changed",
+			"The password for your account was just changed and your other sessions were signed out.\n\n"+
+				"If you did not do this, reset your password immediately and contact support.")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Password changed",
+		"revoked_sessions": revoked,
+	})
+}
+
+// checkPasswordPolicy answers 400 with the broken rules as errors on field
+// when the password is not acceptable for the account, and returns false then.
+func (ac *AuthController) checkPasswordPolicy(c *gin.Context, field, plaintext, email string) bool {
+	violations := ac.passwords.Check(plaintext, email)
+	if len(violations) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Password does not meet the requirements",
+		"error_code": "password_policy",
+		"fields":     gin.H{field: violations},
+	})
+	return false
+}
+
+// issuePasswordResetToken stores a new reset token for the user and returns
+// it, or returns "" when one was already issued within cooldown
+func (ac *AuthController) issuePasswordResetToken(ctx context.Context, q *generated.Queries, userID pgtype.UUID, cooldown time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	created, err := q.CreatePasswordResetToken(ctx, generated.CreatePasswordResetTokenParams{
+		UserID:          userID,
+		TokenHash:       security.HashToken(token),
+		ExpiresAt:       pgtype.Timestamp{Time: time.Now().Add(ac.cfg.PasswordReset.TokenTTL), Valid: true},
+		CooldownSeconds: int32(cooldown.Seconds()),
+	})
+	if err != nil || created == 0 {
+		return "", err
+	}
+	return token, nil
+}
+
+// passwordResetLink is the frontend page that takes a reset token
+func (ac *AuthController) passwordResetLink(token string) (string, error) {
+	link, err := url.Parse(ac.cfg.PasswordReset.URL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// hashNewPassword hashes a password about to be stored. When that fails it
+// has already answered the request and returns false.
+func (ac *AuthController) hashNewPassword(c *gin.Context, plaintext string) (string, bool) {
+	hash, err := ac.hasher.Hash(plaintext)
+	if errors.Is(err, password.ErrTooLong) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is too long"})
+		return "", false
+	}
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return "", false
+	}
+	return hash, true
+}
+
+// passwordMatches checks a password against the user's stored hash and says
+// whether that hash is due for an upgrade. Accounts without a password and
+// hashes that cannot be read never match.
+func (ac *AuthController) passwordMatches(user generated.User, plaintext string) (match, rehash bool) {
+	if !user.PasswordHash.Valid || user.PasswordHash.String == "" {
+		return false, false
+	}
+	match, rehash, err := ac.hasher.Verify(plaintext, user.PasswordHash.String)
+	if err != nil {
+		log.Printf("Failed to verify password hash for user %v: %v", user.ID, err)
+		return false, false
+	}
+	return match, rehash
+}
+
+// rehashPassword replaces the user's stored hash with one made under the
+// current settings, as long as the password has not changed in the meantime
+func (ac *AuthController) rehashPassword(c *gin.Context, user generated.User, plaintext string) {
+	hash, err := ac.hasher.Hash(plaintext)
+	if err != nil {
+		log.Printf("Failed to rehash password for user %v: %v", user.ID, err)
+		return
+	}
+	_, err = ac.db.ReplacePasswordHash(c.Request.Context(), generated.ReplacePasswordHashParams{
+		ID:      user.ID,
+		OldHash: user.PasswordHash,
+		NewHash: pgtype.Text{String: hash, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Failed to store rehashed password for user %v: %v", user.ID, err)
+	}
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/security"
+	jwt "auth-service/src/utils"
+)
+
+// RefreshRequest lets body-mode clients present their refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+// Refresh exchanges a refresh token for a new token pair. The token is taken
+// from the request body when given there and from the refresh_token cookie
+// otherwise; ?token_delivery=body returns the new pair in the body too.
+//
+// Every login creates one sessions row, which is the refresh token family:
+// each call rotates the row's refresh token in place. A token that is
+// validly signed but no longer stored on its session has already been
+// rotated, so presenting it again revokes the whole session as suspected theft.
+func (ac *AuthController) Refresh(c *gin.Context) {
+	inBody, err := tokensInBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req RefreshRequest
+	_ = c.ShouldBind(&req) // an empty body is fine, the cookie is the fallback
+
+	refreshToken := req.RefreshToken
+	if refreshToken == "" {
+		refreshToken, _ = c.Cookie("refresh_token")
+	}
+	if refreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 1. Validate signature, expiry and token type
+	claims, err := jwt.ValidateToken(refreshToken, jwt.AudienceAuth)
+	if err != nil || claims.Type != "refresh" {
+		ac.clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+
+	// 2. Find the session that currently holds this token
+	session, err := ac.db.GetSessionByRefreshTokenHash(ctx, hashedToken(refreshToken))
+	if errors.Is(err, pgx.ErrNoRows) {
+		ac.revokeTokenFamily(ctx, claims)
+		ac.clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetSessionByRefreshTokenHash during refresh: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	if session.RevokedAt.Valid {
+		ac.clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
+	}
+
+	// 3. Generate the next token pair for the same session. The user is
+	// reloaded so a freshly verified email lifts the restriction.
+	user, err := ac.db.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		log.Printf("Failed to load user during refresh: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	accessToken, err := ac.generateAccessToken(ctx, user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		return
+	}
+
+	newRefreshToken, err := jwt.GenerateRefreshToken(session.UserID, claims.Email, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		return
+	}
+
+	// 4. Rotate. The update only matches while the presented token is still
+	// current, so a concurrent use of the same token loses and is treated as reuse.
+	expiresAt := time.Now().Add(jwt.RefreshTokenDuration)
+	_, err = ac.db.RotateSessionToken(ctx, generated.RotateSessionTokenParams{
+		NewRefreshTokenHash: hashedToken(newRefreshToken),
+		ExpiresAt:           pgtype.Timestamp{Time: expiresAt, Valid: true},
+		ID:                  session.ID,
+		OldRefreshTokenHash: hashedToken(refreshToken),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		ac.revokeTokenFamily(ctx, &jwt.Claims{UserID: session.UserID, SessionID: session.ID})
+		ac.clearAuthCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to rotate session during refresh: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store session"})
+		return
+	}
+
+	// 5. Hand out the new pair and respond
+	resp := gin.H{
+		"message": "Token refreshed successfully",
+	}
+	ac.deliverTokens(c, resp, inBody, accessToken, newRefreshToken, ac.cfg.Cookie.SameSiteMode())
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// revokeTokenFamily revokes the session a replayed refresh token belongs to.
+// Tokens issued before sessions were embedded in the claims carry no sid and
+// cannot be traced back to a family.
+func (ac *AuthController) revokeTokenFamily(ctx context.Context, claims *jwt.Claims) {
+	if !claims.SessionID.Valid {
+		log.Printf("Refresh token reuse for user %v without session id; nothing to revoke", claims.UserID)
+		return
+	}
+
+	revoked, err := ac.db.RevokeSession(ctx, generated.RevokeSessionParams{
+		ID:     claims.SessionID,
+		UserID: claims.UserID,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke session %v after refresh token reuse: %v", claims.SessionID, err)
+		return
+	}
+	log.Printf("Refresh token reuse detected: revoked %d session(s) for user %v", revoked, claims.UserID)
+}
+
+// hashedToken is the form refresh tokens are stored and looked up in
+func hashedToken(token string) pgtype.Text {
+	return pgtype.Text{String: security.HashToken(token), Valid: true}
+}
+
+// HashLegacyRefreshTokens hashes refresh tokens stored in plaintext before
+// hashing was introduced and clears the plaintext column. It runs at startup
+// and is a no-op once every row has been migrated.
+func (ac *AuthController) HashLegacyRefreshTokens(ctx context.Context) (int, error) {
+	rows, err := ac.db.ListUnhashedSessions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		err := ac.db.SetSessionRefreshTokenHash(ctx, generated.SetSessionRefreshTokenHashParams{
+			ID:               row.ID,
+			RefreshTokenHash: hashedToken(row.RefreshToken.String),
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(rows), nil
+}
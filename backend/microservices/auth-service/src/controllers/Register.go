@@ -1,17 +1,18 @@
 package auth
 
 import (
-	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
-	"golang.org/x/crypto/bcrypt"
 
 	generated "auth-service/src/db/generated"
+	"auth-service/src/security"
 	jwt "auth-service/src/utils"
 
 	ua "github.com/mssola/user_agent"
@@ -19,13 +20,14 @@ import (
 
 type RegisterRequest struct {
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
 }
 
 type RegisterResponse struct {
-	ID        pgtype.UUID      `json:"id"`
-	Email     string           `json:"email"`
-	CreatedAt pgtype.Timestamp `json:"created_at"`
+	ID            pgtype.UUID      `json:"id"`
+	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
+	CreatedAt     pgtype.Timestamp `json:"created_at"`
 }
 
 func (rc *AuthController) Register(c *gin.Context) {
@@ -35,76 +37,80 @@ func (rc *AuthController) Register(c *gin.Context) {
 		return
 	}
 
+	inBody, err := tokensInBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx := c.Request.Context()
 
 	// 1. Check if email already exists
-	_, err := rc.db.FindUserByEmail(ctx, req.Email)
+	_, err = rc.db.FindUserByEmail(ctx, req.Email)
 	if err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
 		return
 	}
-	// 2. Hash password
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+	// 2. Check and hash password
+	if !rc.checkPasswordPolicy(c, "password", req.Password, req.Email) {
+		return
+	}
+	hash, ok := rc.hashNewPassword(c, req.Password)
+	if !ok {
 		return
 	}
 
 	// 3. Create user
 	user, err := rc.db.CreateUser(ctx, generated.CreateUserParams{
 		Email:           req.Email,
-		PasswordHash:    pgtype.Text{String: string(hash), Valid: true},
+		PasswordHash:    pgtype.Text{String: hash, Valid: true},
 		OauthProvider:   pgtype.Text{Valid: false},
 		OauthProviderID: pgtype.Text{Valid: false},
 		MfaEnabled:      pgtype.Bool{Bool: false, Valid: true},
+		EmailVerified:   false,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	// -------------------------------------------------
-	// 4. Ensure default "user" role exists and assign it
-	// -------------------------------------------------
-	var roleID pgtype.UUID
+	if err := rc.sendVerificationEmail(ctx, user); err != nil {
+		log.Printf("Failed to send verification email after registration: %v", err)
+	}
 
-	role, err := rc.db.FindRoleByName(ctx, "user")
+	// 4. Assign the default role
+	if err := rc.assignDefaultRole(ctx, user.ID); err != nil {
+		log.Printf("Failed to assign the default role to user %v: %v", user.ID, err)
+	}
 
-	if err == sql.ErrNoRows {
-		// Create the default role
-		newRole, err := rc.db.CreateRole(ctx, generated.CreateRoleParams{
-			Name:        "user",
-			Description: pgtype.Text{String: "Default user role", Valid: true},
-		})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create default role"})
-			return
-		}
-		roleID = newRole.ID
-	} else {
-		roleID = role.ID
+	userResp := RegisterResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
 	}
 
-	// Assign role to user
-	_, err = rc.db.CreateUserRole(ctx, generated.CreateUserRoleParams{
-		UserID: user.ID,
-		RoleID: roleID,
-	})
-	if err != nil {
-		// Non-critical – we still continue, but you might want to log this
-		// c.JSON(http.StatusInternalServerError, ...)
+	// Without verification there is nothing to log in to yet
+	if rc.loginBlocked(user) {
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "User registered; check your email to verify your address before logging in",
+			"user":    userResp,
+		})
+		return
 	}
 
 	// -------------------------------------------------
 	// 5. Generate tokens (auto-login)
 	// -------------------------------------------------
-	accessToken, err := jwt.GenerateAccessToken(user.ID, user.Email)
+	sessionID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	accessToken, err := rc.generateAccessToken(ctx, user, sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
 		return
 	}
 
-	refreshToken, err := jwt.GenerateRefreshToken(user.ID, user.Email)
+	refreshToken, err := jwt.GenerateRefreshToken(user.ID, user.Email, sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
 		return
@@ -113,9 +119,10 @@ func (rc *AuthController) Register(c *gin.Context) {
 	// Store refresh token in sessions table
 	expiresAt := time.Now().Add(7 * 24 * time.Hour)
 	_, err = rc.db.CreateSession(ctx, generated.CreateSessionParams{
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		ExpiresAt:    pgtype.Timestamp{Time: expiresAt, Valid: true},
+		ID:               sessionID,
+		UserID:           user.ID,
+		RefreshTokenHash: pgtype.Text{String: security.HashToken(refreshToken), Valid: true},
+		ExpiresAt:        pgtype.Timestamp{Time: expiresAt, Valid: true},
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store session"})
@@ -168,30 +175,29 @@ func (rc *AuthController) Register(c *gin.Context) {
 		deviceName = "Bot/Crawler"
 	}
 
-	_, err = rc.db.CreateDevice(ctx, generated.CreateDeviceParams{
+	device, err := rc.db.CreateDevice(ctx, generated.CreateDeviceParams{
 		UserID:     user.ID,
 		DeviceName: pgtype.Text{String: deviceName, Valid: true},
 		DeviceType: pgtype.Text{String: deviceType, Valid: true},
 		IpAddress:  pgtype.Text{String: clientIP, Valid: true},
 		LastSeen:   pgtype.Timestamp{Time: time.Now(), Valid: true},
 	})
-	if err != nil {
-		// Non-critical – log in production, continue
+	if err == nil {
+		// Link the session to the device so /sessions can show where it lives
+		_ = rc.db.AttachSessionDevice(ctx, generated.AttachSessionDeviceParams{
+			ID:       sessionID,
+			DeviceID: device.ID,
+		})
 	}
 
 	// -------------------------------------------------
-	// 7. Set cookies and respond (same as login)
+	// 7. Hand out the tokens and respond (same as login)
 	// -------------------------------------------------
-	c.SetSameSite(http.SameSiteStrictMode)
-	c.SetCookie("access_token", accessToken, 15*60, "/", "", false, true)        // 15 min
-	c.SetCookie("refresh_token", refreshToken, 7*24*60*60, "/", "", false, true) // 7 days
-
-	c.JSON(http.StatusCreated, gin.H{
+	resp := gin.H{
 		"message": "User registered and logged in successfully",
-		"user": RegisterResponse{
-			ID:        user.ID,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt,
-		},
-	})
+		"user":    userResp,
+	}
+	rc.deliverTokens(c, resp, inBody, accessToken, refreshToken, rc.cfg.Cookie.SameSiteMode())
+
+	c.JSON(http.StatusCreated, resp)
 }
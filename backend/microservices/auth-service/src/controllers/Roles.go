@@ -0,0 +1,530 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/rbac"
+)
+
+// uniqueViolation is the Postgres SQLSTATE for a unique constraint failure
+const uniqueViolation = "23505"
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+
+var (
+	errRoleExists      = errors.New("role already exists")
+	errLastAdmin       = errors.New("cannot remove the last admin")
+	errRoleNotAssigned = errors.New("role is not assigned to the user")
+)
+
+// unknownPermissionsError lists requested permissions that do not exist
+type unknownPermissionsError []string
+
+func (e unknownPermissionsError) Error() string {
+	return "unknown permissions: " + strings.Join(e, ", ")
+}
+
+type RoleResponse struct {
+	ID          pgtype.UUID `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Permissions []string    `json:"permissions"`
+	MemberCount *int64      `json:"member_count,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+type PermissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest changes only the fields that are present. Permissions,
+// when given, replace everything the role was granted before.
+type UpdateRoleRequest struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ListPermissions returns every permission a role can be granted
+func (ac *AuthController) ListPermissions(c *gin.Context) {
+	rows, err := ac.db.ListPermissions(c.Request.Context())
+	if err != nil {
+		log.Printf("DATABASE ERROR in ListPermissions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch permissions"})
+		return
+	}
+
+	permissions := make([]PermissionResponse, 0, len(rows))
+	for _, row := range rows {
+		permissions = append(permissions, PermissionResponse{Name: row.Name, Description: row.Description.String})
+	}
+	c.JSON(http.StatusOK, gin.H{"permissions": permissions})
+}
+
+// ListRoles returns every role with its permissions and number of members
+func (ac *AuthController) ListRoles(c *gin.Context) {
+	rows, err := ac.db.ListRoles(c.Request.Context())
+	if err != nil {
+		log.Printf("DATABASE ERROR in ListRoles: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch roles"})
+		return
+	}
+
+	roles := make([]RoleResponse, 0, len(rows))
+	for _, row := range rows {
+		roles = append(roles, RoleResponse{
+			ID:          row.ID,
+			Name:        row.Name,
+			Description: row.Description.String,
+			Permissions: row.Permissions,
+			MemberCount: &row.MemberCount,
+			CreatedAt:   row.CreatedAt.Time,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// CreateRole adds a role and grants it the requested permissions
+func (ac *AuthController) CreateRole(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Role names are up to 64 lower-case letters, digits, '-' and '_', starting with a letter",
+			"error_code": "invalid_role_name",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 1. Names are unique
+	_, err := ac.db.FindRoleByName(ctx, name)
+	if err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "A role with that name already exists", "error_code": "role_exists"})
+		return
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("DATABASE ERROR in FindRoleByName: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+
+	// 2. Create it together with its grants
+	var role generated.Role
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		var err error
+		role, err = q.CreateRole(ctx, generated.CreateRoleParams{
+			Name:        name,
+			Description: pgtype.Text{String: req.Description, Valid: req.Description != ""},
+		})
+		if isUniqueViolation(err) {
+			return errRoleExists
+		}
+		if err != nil {
+			return err
+		}
+		return setRolePermissions(ctx, q, role.ID, req.Permissions)
+	})
+	if ac.roleWriteFailed(c, err) {
+		return
+	}
+
+	ac.audit(c, actorID, AuditRoleCreated, gin.H{"role": name, "permissions": req.Permissions})
+	ac.respondWithRole(c, http.StatusCreated, role)
+}
+
+// UpdateRole renames a role, changes its description or replaces its
+// permissions. Changes apply from the next request of every member.
+func (ac *AuthController) UpdateRole(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+
+	var roleID pgtype.UUID
+	if err := roleID.Scan(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role id"})
+		return
+	}
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 1. Load the role
+	role, err := ac.db.GetRoleByID(ctx, roleID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetRoleByID: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	// 2. Work out the new values; built-in roles keep their names
+	params := generated.UpdateRoleParams{ID: role.ID, Name: role.Name, Description: role.Description}
+	if req.Name != nil {
+		params.Name = strings.TrimSpace(*req.Name)
+		if !roleNamePattern.MatchString(params.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      "Role names are up to 64 lower-case letters, digits, '-' and '_', starting with a letter",
+				"error_code": "invalid_role_name",
+			})
+			return
+		}
+	}
+	if req.Description != nil {
+		params.Description = pgtype.Text{String: *req.Description, Valid: *req.Description != ""}
+	}
+	oldName := role.Name
+	renamed := params.Name != oldName
+	if (renamed && rbac.IsBuiltin(role.Name)) || (req.Permissions != nil && role.Name == rbac.RoleAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Built-in roles cannot be changed this way", "error_code": "protected_role"})
+		return
+	}
+
+	// 3. Save
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		var err error
+		role, err = q.UpdateRole(ctx, params)
+		if isUniqueViolation(err) {
+			return errRoleExists
+		}
+		if err != nil {
+			return err
+		}
+		if req.Permissions == nil {
+			return nil
+		}
+		return setRolePermissions(ctx, q, role.ID, *req.Permissions)
+	})
+	if ac.roleWriteFailed(c, err) {
+		return
+	}
+
+	metadata := gin.H{"role": role.Name}
+	if renamed {
+		metadata["renamed_from"] = oldName
+	}
+	if req.Permissions != nil {
+		metadata["permissions"] = *req.Permissions
+	}
+	ac.audit(c, actorID, AuditRoleUpdated, metadata)
+	ac.respondWithRole(c, http.StatusOK, role)
+}
+
+// DeleteRole removes a role and every assignment of it
+func (ac *AuthController) DeleteRole(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+
+	var roleID pgtype.UUID
+	if err := roleID.Scan(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	role, err := ac.db.GetRoleByID(ctx, roleID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetRoleByID: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if rbac.IsBuiltin(role.Name) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Built-in roles cannot be deleted", "error_code": "protected_role"})
+		return
+	}
+
+	deleted, err := ac.db.DeleteRole(ctx, role.ID)
+	if err != nil {
+		log.Printf("DATABASE ERROR in DeleteRole: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	ac.audit(c, actorID, AuditRoleDeleted, gin.H{"role": role.Name})
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// AssignRole gives a user a role. Assigning a role the user already has
+// succeeds without changing anything.
+func (ac *AuthController) AssignRole(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+
+	var userID pgtype.UUID
+	if err := userID.Scan(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 1. Both sides must exist
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && user.DeletedAt.Valid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetUserByID: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+	role, err := ac.db.FindRoleByName(ctx, strings.TrimSpace(req.Role))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in FindRoleByName: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+
+	// 2. Assign
+	if _, err := ac.db.CreateUserRole(ctx, generated.CreateUserRoleParams{UserID: user.ID, RoleID: role.ID}); err != nil {
+		log.Printf("DATABASE ERROR in CreateUserRole: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign role"})
+		return
+	}
+
+	ac.audit(c, user.ID, AuditRoleAssigned, gin.H{"role": role.Name, "by": actorID})
+	ac.respondWithUserRoles(c, user.ID)
+}
+
+// UnassignRole takes a role away from a user. The admin role cannot be taken
+// from the last active admin.
+func (ac *AuthController) UnassignRole(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	actorID := val.(pgtype.UUID)
+
+	var userID pgtype.UUID
+	if err := userID.Scan(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	role, err := ac.db.FindRoleByName(ctx, c.Param("role"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("DATABASE ERROR in FindRoleByName: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove role"})
+		return
+	}
+
+	// Concurrent removals of the admin role queue on the role's row, so two
+	// admins cannot demote each other at the same time
+	err = ac.withTx(ctx, func(q *generated.Queries) error {
+		if role.Name == rbac.RoleAdmin {
+			if err := q.LockRole(ctx, role.ID); err != nil {
+				return err
+			}
+		}
+		removed, err := q.DeleteUserRole(ctx, generated.DeleteUserRoleParams{UserID: userID, RoleID: role.ID})
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return errRoleNotAssigned
+		}
+		if role.Name != rbac.RoleAdmin {
+			return nil
+		}
+		remaining, err := q.CountActiveRoleMembers(ctx, role.ID)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return errLastAdmin
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errRoleNotAssigned):
+		c.JSON(http.StatusNotFound, gin.H{"error": "The user does not have this role"})
+		return
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "The last admin cannot lose the admin role", "error_code": "last_admin"})
+		return
+	case err != nil:
+		log.Printf("DATABASE ERROR removing role %s from user %v: %v", role.Name, userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove role"})
+		return
+	}
+
+	ac.audit(c, userID, AuditRoleUnassigned, gin.H{"role": role.Name, "by": actorID})
+	ac.respondWithUserRoles(c, userID)
+}
+
+// setRolePermissions replaces the role's grants with the named permissions
+func setRolePermissions(ctx context.Context, q *generated.Queries, roleID pgtype.UUID, names []string) error {
+	names = slices.Compact(slices.Sorted(slices.Values(names)))
+
+	if err := q.DeleteRolePermissions(ctx, roleID); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	granted, err := q.GrantRolePermissions(ctx, generated.GrantRolePermissionsParams{RoleID: roleID, Names: names})
+	if err != nil {
+		return err
+	}
+	if granted == int64(len(names)) {
+		return nil
+	}
+
+	// Name the ones that do not exist
+	known, err := q.GetRolePermissionNames(ctx, roleID)
+	if err != nil {
+		return err
+	}
+	var unknown unknownPermissionsError
+	for _, name := range names {
+		if !slices.Contains(known, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// roleWriteFailed answers for a failed role create or update and reports
+// whether it did
+func (ac *AuthController) roleWriteFailed(c *gin.Context, err error) bool {
+	var unknown unknownPermissionsError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errRoleExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "A role with that name already exists", "error_code": "role_exists"})
+	case errors.As(err, &unknown):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permissions", "error_code": "unknown_permission", "permissions": []string(unknown)})
+	default:
+		log.Printf("DATABASE ERROR saving role: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save role"})
+	}
+	return true
+}
+
+// assignDefaultRole gives a new account the user role, which rbac.Seed
+// creates at startup
+func (ac *AuthController) assignDefaultRole(ctx context.Context, userID pgtype.UUID) error {
+	role, err := ac.db.FindRoleByName(ctx, rbac.RoleUser)
+	if err != nil {
+		return fmt.Errorf("find role %s: %w", rbac.RoleUser, err)
+	}
+	_, err = ac.db.CreateUserRole(ctx, generated.CreateUserRoleParams{UserID: userID, RoleID: role.ID})
+	return err
+}
+
+func (ac *AuthController) respondWithRole(c *gin.Context, status int, role generated.Role) {
+	permissions, err := ac.db.GetRolePermissionNames(c.Request.Context(), role.ID)
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetRolePermissionNames: %v", err)
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+	c.JSON(status, gin.H{"role": RoleResponse{
+		ID:          role.ID,
+		Name:        role.Name,
+		Description: role.Description.String,
+		Permissions: permissions,
+		CreatedAt:   role.CreatedAt.Time,
+	}})
+}
+
+func (ac *AuthController) respondWithUserRoles(c *gin.Context, userID pgtype.UUID) {
+	roles, err := ac.db.GetUserRoleNames(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("DATABASE ERROR in GetUserRoleNames: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch roles"})
+		return
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "roles": roles})
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+)
+
+type SessionResponse struct {
+	ID        pgtype.UUID            `json:"id"`
+	Current   bool                   `json:"current"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	ExpiresAt time.Time              `json:"expires_at"`
+	Device    *SessionDeviceResponse `json:"device"`
+}
+
+type SessionDeviceResponse struct {
+	ID        pgtype.UUID `json:"id"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"`
+	IPAddress string      `json:"ip_address"`
+	LastSeen  time.Time   `json:"last_seen"`
+}
+
+// ListSessions returns the caller's active sessions, newest activity first
+func (ac *AuthController) ListSessions(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	currentSessionID, _ := c.Get("session_id")
+
+	rows, err := ac.db.ListActiveSessionsByUser(c.Request.Context(), userID)
+	if err != nil {
+		log.Println("Error listing sessions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch sessions"})
+		return
+	}
+
+	sessions := make([]SessionResponse, 0, len(rows))
+	for _, row := range rows {
+		session := SessionResponse{
+			ID:        row.ID,
+			Current:   row.ID == currentSessionID,
+			CreatedAt: row.CreatedAt.Time,
+			UpdatedAt: row.UpdatedAt.Time,
+			ExpiresAt: row.ExpiresAt.Time,
+		}
+		if row.DeviceID.Valid {
+			session.Device = &SessionDeviceResponse{
+				ID:        row.DeviceID,
+				Name:      row.DeviceName.String,
+				Type:      row.DeviceType.String,
+				IPAddress: row.IpAddress.String,
+				LastSeen:  row.LastSeen.Time,
+			}
+		}
+		sessions = append(sessions, session)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession revokes one of the caller's sessions. Sessions of other
+// users are reported as not found.
+func (ac *AuthController) RevokeSession(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+
+	var sessionID pgtype.UUID
+	if err := sessionID.Scan(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session id"})
+		return
+	}
+
+	revoked, err := ac.db.RevokeSession(c.Request.Context(), generated.RevokeSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Println("Error revoking session:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	// Revoking the session we are using is a logout
+	if current, _ := c.Get("session_id"); current == sessionID {
+		ac.clearAuthCookies(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Session revoked",
+		"revoked_sessions": revoked,
+	})
+}
@@ -0,0 +1,522 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"auth-service/src/config"
+	generated "auth-service/src/db/generated"
+)
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+
+	ceremonyTimeout = 5 * time.Minute
+)
+
+var webAuthn *webauthn.WebAuthn
+
+// Initialize once at startup
+func InitWebAuthn(cfg config.WebAuthnConfig) error {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyTimeout},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	webAuthn = wa
+	log.Println("[InitWebAuthn] WebAuthn relying party initialized for", cfg.RPID)
+	return nil
+}
+
+// PasskeyRegistrationRequest re-authenticates the caller before a passkey is
+// added. Password and Code are as in ReauthRequest.
+type PasskeyRegistrationRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type DeletePasskeyRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type WebAuthnFinishRequest struct {
+	CeremonyID string          `json:"ceremony_id" binding:"required"`
+	Name       string          `json:"name"` // optional label for a new passkey
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type PasskeyResponse struct {
+	ID         pgtype.UUID `json:"id"`
+	Name       string      `json:"name"`
+	Synced     bool        `json:"synced"` // backed up to a cloud keychain
+	CreatedAt  time.Time   `json:"created_at"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+}
+
+// BeginPasskeyRegistration returns the options for navigator.credentials.create.
+// Passkeys must be discoverable and user-verified so they can later log in
+// without a username and stand in for a second factor. Because a passkey
+// skips TOTP at login, a session alone is not enough to add one: the caller
+// re-authenticates here, and FinishPasskeyRegistration only accepts the
+// ceremony this started.
+func (ac *AuthController) BeginPasskeyRegistration(c *gin.Context) {
+	var req PasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	// 1. Load the user
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user for passkey registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 2. Re-authenticate
+	if !ac.confirmIdentity(c, user, req.Password, req.Code, "add a passkey") {
+		return
+	}
+
+	passkeyUser, err := ac.loadPasskeyUser(ctx, user)
+	if err != nil {
+		log.Printf("Failed to load passkeys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 3. Build the creation options
+	options, session, err := webAuthn.BeginRegistration(passkeyUser,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		}),
+		webauthn.WithExclusions(webauthn.Credentials(passkeyUser.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		log.Printf("Failed to begin passkey registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	// 4. Remember the challenge until the browser answers
+	ceremonyID, err := ac.saveCeremony(ctx, userID, ceremonyRegistration, session)
+	if err != nil {
+		log.Printf("Failed to store passkey registration ceremony: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"options":     options,
+	})
+}
+
+// FinishPasskeyRegistration verifies the authenticator's attestation and stores the passkey
+func (ac *AuthController) FinishPasskeyRegistration(c *gin.Context) {
+	var req WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	// 1. Take the ceremony; it must have been started by the same user
+	session, ceremonyUserID, err := ac.takeCeremony(ctx, req.CeremonyID, ceremonyRegistration)
+	if err != nil || ceremonyUserID != userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or expired passkey ceremony"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey credential"})
+		return
+	}
+
+	// 2. Verify the attestation against the challenge
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user for passkey registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	passkeyUser, err := ac.loadPasskeyUser(ctx, user)
+	if err != nil {
+		log.Printf("Failed to load passkeys: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	credential, err := webAuthn.CreateCredential(passkeyUser, *session, parsed)
+	if err != nil {
+		log.Printf("Passkey registration failed for user %v: %v", userID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	// 3. Store it
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+
+	row, err := ac.db.CreateWebauthnCredential(ctx, generated.CreateWebauthnCredentialParams{
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Aaguid:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Transports:      transports,
+		Attachment:      pgtype.Text{String: string(credential.Authenticator.Attachment), Valid: credential.Authenticator.Attachment != ""},
+		Name:            pgtype.Text{String: req.Name, Valid: req.Name != ""},
+	})
+	if err != nil {
+		log.Printf("Failed to store passkey: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store passkey"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Passkey registered",
+		"passkey": passkeyResponse(row),
+	})
+}
+
+// BeginPasskeyLogin starts a usernameless login: the browser lets the user
+// pick any passkey they hold for this site.
+func (ac *AuthController) BeginPasskeyLogin(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	options, session, err := webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		log.Printf("Failed to begin passkey login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	ceremonyID, err := ac.saveCeremony(ctx, pgtype.UUID{}, ceremonyLogin, session)
+	if err != nil {
+		log.Printf("Failed to store passkey login ceremony: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{
+		"ceremony_id": ceremonyID,
+		"options":     options,
+	})
+}
+
+// FinishPasskeyLogin verifies the assertion and logs the user in exactly like
+// Login does. A user-verified passkey already proves possession and identity,
+// so no TOTP challenge follows.
+func (ac *AuthController) FinishPasskeyLogin(c *gin.Context) {
+	var req WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	inBody, err := tokensInBody(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// 1. Take the ceremony
+	session, _, err := ac.takeCeremony(ctx, req.CeremonyID, ceremonyLogin)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or expired passkey ceremony"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey credential"})
+		return
+	}
+
+	// 2. Resolve the passkey's owner from the user handle and verify the signature
+	var (
+		stored generated.WebauthnCredential
+		user   generated.User
+	)
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		stored, err = ac.db.GetWebauthnCredentialByCredentialID(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(stored.UserID.Bytes[:], userHandle) {
+			return nil, errors.New("credential does not belong to the presented user handle")
+		}
+
+		user, err = ac.db.GetUserByID(ctx, stored.UserID)
+		if err != nil {
+			return nil, err
+		}
+		return ac.loadPasskeyUser(ctx, user)
+	}
+
+	_, credential, err := webAuthn.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		log.Printf("Passkey login failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	// 3. Track the signature counter; going backwards hints at a cloned key
+	err = ac.db.UpdateWebauthnCredentialUsage(ctx, generated.UpdateWebauthnCredentialUsageParams{
+		ID:           stored.ID,
+		SignCount:    int64(credential.Authenticator.SignCount),
+		CloneWarning: credential.Authenticator.CloneWarning,
+		BackupState:  credential.Flags.BackupState,
+	})
+	if err != nil {
+		log.Printf("Failed to update passkey usage: %v", err)
+	}
+
+	if credential.Authenticator.CloneWarning {
+		log.Printf("Passkey %v of user %v rejected: signature counter went backwards", stored.ID, user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey verification failed"})
+		return
+	}
+
+	// 4. Log in
+	ac.finishLogin(c, user, inBody)
+}
+
+// ListPasskeys returns the caller's registered passkeys
+func (ac *AuthController) ListPasskeys(c *gin.Context) {
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+
+	rows, err := ac.db.ListWebauthnCredentialsByUser(c.Request.Context(), userID)
+	if err != nil {
+		log.Println("Error listing passkeys:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch passkeys"})
+		return
+	}
+
+	passkeys := make([]PasskeyResponse, 0, len(rows))
+	for _, row := range rows {
+		passkeys = append(passkeys, passkeyResponse(row))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passkeys": passkeys})
+}
+
+// DeletePasskey removes one of the caller's passkeys. Like adding one, it
+// needs re-authentication: a stolen session could otherwise strip the
+// owner's sign-in methods.
+func (ac *AuthController) DeletePasskey(c *gin.Context) {
+	var req DeletePasskeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	val, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	userID := val.(pgtype.UUID)
+	ctx := c.Request.Context()
+
+	var passkeyID pgtype.UUID
+	if err := passkeyID.Scan(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey id"})
+		return
+	}
+
+	// 1. Load the user
+	user, err := ac.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to load user for passkey removal: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server error"})
+		return
+	}
+
+	// 2. Re-authenticate
+	if !ac.confirmIdentity(c, user, req.Password, req.Code, "remove a passkey") {
+		return
+	}
+
+	// 3. Remove it
+	deleted, err := ac.db.DeleteWebauthnCredential(ctx, generated.DeleteWebauthnCredentialParams{
+		ID:     passkeyID,
+		UserID: userID,
+	})
+	if err != nil {
+		log.Printf("Failed to delete passkey: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if deleted == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	ac.audit(c, userID, AuditPasskeyDeleted, gin.H{"passkey_id": passkeyID})
+	ac.notify(user.Email, "A passkey was removed from your account",
+		"A passkey was removed from your account and can no longer be used to sign in.\n\n"+
+			"If you did not do this, reset your password and review your active sessions immediately.")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted"})
+}
+
+// passkeyUser adapts a users row to the webauthn.User interface. The user
+// handle is the raw user ID, which is what discoverable logins hand back.
+type passkeyUser struct {
+	user        generated.User
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return u.user.ID.Bytes[:] }
+func (u *passkeyUser) WebAuthnName() string                       { return u.user.Email }
+func (u *passkeyUser) WebAuthnDisplayName() string                { return u.user.Email }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func (ac *AuthController) loadPasskeyUser(ctx context.Context, user generated.User) (*passkeyUser, error) {
+	rows, err := ac.db.ListWebauthnCredentialsByUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(rows))
+	for _, row := range rows {
+		transports := make([]protocol.AuthenticatorTransport, len(row.Transports))
+		for i, t := range row.Transports {
+			transports[i] = protocol.AuthenticatorTransport(t)
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              row.CredentialID,
+			PublicKey:       row.PublicKey,
+			AttestationType: row.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: row.BackupEligible,
+				BackupState:    row.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       row.Aaguid,
+				SignCount:    uint32(row.SignCount),
+				CloneWarning: row.CloneWarning,
+				Attachment:   protocol.AuthenticatorAttachment(row.Attachment.String),
+			},
+		})
+	}
+	return &passkeyUser{user: user, credentials: credentials}, nil
+}
+
+// saveCeremony stores the session data of a ceremony in flight. Keeping it in
+// the database rather than in memory lets any replica finish the ceremony.
+func (ac *AuthController) saveCeremony(ctx context.Context, userID pgtype.UUID, kind string, session *webauthn.SessionData) (pgtype.UUID, error) {
+	if _, err := ac.db.DeleteExpiredWebauthnCeremonies(ctx); err != nil {
+		log.Printf("Failed to prune expired passkey ceremonies: %v", err)
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+
+	return ac.db.CreateWebauthnCeremony(ctx, generated.CreateWebauthnCeremonyParams{
+		UserID:      userID,
+		Kind:        kind,
+		SessionData: data,
+		ExpiresAt:   pgtype.Timestamp{Time: time.Now().Add(ceremonyTimeout), Valid: true},
+	})
+}
+
+// takeCeremony loads and deletes a ceremony, so each challenge is answered once
+func (ac *AuthController) takeCeremony(ctx context.Context, id, kind string) (*webauthn.SessionData, pgtype.UUID, error) {
+	var ceremonyID pgtype.UUID
+	if err := ceremonyID.Scan(id); err != nil {
+		return nil, pgtype.UUID{}, err
+	}
+
+	row, err := ac.db.TakeWebauthnCeremony(ctx, generated.TakeWebauthnCeremonyParams{
+		ID:   ceremonyID,
+		Kind: kind,
+	})
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Failed to load passkey ceremony: %v", err)
+		}
+		return nil, pgtype.UUID{}, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(row.SessionData, &session); err != nil {
+		return nil, pgtype.UUID{}, err
+	}
+	return &session, row.UserID, nil
+}
+
+func passkeyResponse(row generated.WebauthnCredential) PasskeyResponse {
+	resp := PasskeyResponse{
+		ID:        row.ID,
+		Name:      row.Name.String,
+		Synced:    row.BackupState,
+		CreatedAt: row.CreatedAt.Time,
+	}
+	if row.LastUsedAt.Valid {
+		resp.LastUsedAt = &row.LastUsedAt.Time
+	}
+	return resp
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+)
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	id := newUUID()
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		want      time.Time
+	}{
+		{"microseconds", time.Date(2025, 3, 1, 9, 30, 0, 123456000, time.UTC), time.Date(2025, 3, 1, 9, 30, 0, 123456000, time.UTC)},
+		{"nanoseconds are dropped like Postgres does", time.Date(2025, 3, 1, 9, 30, 0, 123456789, time.UTC), time.Date(2025, 3, 1, 9, 30, 0, 123456000, time.UTC)},
+		{"other zone", time.Date(2025, 3, 1, 10, 30, 0, 0, time.FixedZone("CET", 3600)), time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{"before 1970", time.Date(1969, 7, 20, 20, 17, 0, 0, time.UTC), time.Date(1969, 7, 20, 20, 17, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := encodeUserCursor(tt.createdAt, id)
+			if strings.ContainsAny(cursor, "+/=") {
+				t.Errorf("cursor %q is not URL safe", cursor)
+			}
+
+			createdAt, gotID, err := decodeUserCursor(cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !createdAt.Equal(tt.want) || createdAt.Location() != time.UTC || gotID != id {
+				t.Errorf("decoded %v, %v; want %v, %v", createdAt, gotID, tt.want, id)
+			}
+		})
+	}
+}
+
+func TestDecodeUserCursorRejects(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for name, cursor := range map[string]string{
+		"not base64":     "!!!",
+		"padded base64":  base64.URLEncoding.EncodeToString([]byte("1:" + newUUID().String())),
+		"no separator":   encode("1740821400000000"),
+		"time not a num": encode("yesterday:" + newUUID().String()),
+		"bad id":         encode("1740821400000000:42"),
+	} {
+		if _, _, err := decodeUserCursor(cursor); err == nil {
+			t.Errorf("%s: %q accepted", name, cursor)
+		}
+	}
+}
+
+func TestParseUserFilters(t *testing.T) {
+	cursorAt := time.Date(2025, 3, 1, 9, 30, 0, 0, time.UTC)
+	cursorID := newUUID()
+	cursor := encodeUserCursor(cursorAt, cursorID)
+
+	tests := []struct {
+		name      string
+		query     string
+		want      generated.ListUsersParams
+		wantLimit int
+		wantErr   string
+	}{
+		{"defaults", "", generated.ListUsersParams{}, defaultUserPageSize, ""},
+		{"every filter", "limit=10&email=+ada+&provider=google&role=admin" +
+			"&created_after=2025-01-01T00:00:00Z&created_before=2025-02-01T01:00:00%2B01:00&min_risk=10&max_risk=90&cursor=" + cursor,
+			generated.ListUsersParams{
+				EmailPrefix:     pgtype.Text{String: "ada", Valid: true},
+				Provider:        pgtype.Text{String: "google", Valid: true},
+				Role:            pgtype.Text{String: "admin", Valid: true},
+				CreatedAfter:    pgtype.Timestamp{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+				CreatedBefore:   pgtype.Timestamp{Time: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+				MinRisk:         pgtype.Int4{Int32: 10, Valid: true},
+				MaxRisk:         pgtype.Int4{Int32: 90, Valid: true},
+				CursorCreatedAt: pgtype.Timestamp{Time: cursorAt, Valid: true},
+				CursorID:        cursorID,
+			}, 10, ""},
+		{"largest page", "limit=200", generated.ListUsersParams{}, maxUserPageSize, ""},
+		{"page too large", "limit=201", generated.ListUsersParams{}, 0, "limit must be between 1 and 200"},
+		{"empty page", "limit=0", generated.ListUsersParams{}, 0, "limit must be between 1 and 200"},
+		{"unknown provider", "provider=github", generated.ListUsersParams{}, 0, "provider must be one of password, google"},
+		{"date without time", "created_after=2025-01-01", generated.ListUsersParams{}, 0, "created_after must be an RFC 3339 time"},
+		{"risk out of range", "max_risk=99999999999", generated.ListUsersParams{}, 0, "max_risk must be an integer"},
+		{"tampered cursor", "cursor=" + cursor[:len(cursor)-4], generated.ListUsersParams{}, 0, "cursor is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/admin/users?"+tt.query, nil)
+
+			params, limit, err := parseUserFilters(c)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params != tt.want || limit != tt.wantLimit {
+				t.Errorf("got %+v, limit %d\nwant %+v, limit %d", params, limit, tt.want, tt.wantLimit)
+			}
+		})
+	}
+}
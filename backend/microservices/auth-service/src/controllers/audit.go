@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/mailer"
+)
+
+// Audit event types
+const (
+	AuditMfaEnabled               = "mfa.enabled"
+	AuditMfaDisabled              = "mfa.disabled"
+	AuditRecoveryCodeUsed         = "mfa.recovery_code_used"
+	AuditRecoveryCodesRegenerated = "mfa.recovery_codes_regenerated"
+	AuditPasskeyDeleted           = "passkey.deleted"
+	AuditEmailVerified            = "email.verified"
+	AuditPasswordReset            = "password.reset"
+	AuditPasswordChanged          = "password.changed"
+	AuditPasswordSet              = "password.set"
+	AuditAccountExported          = "account.exported"
+	AuditAccountDeletionScheduled = "account.deletion_scheduled"
+	AuditAccountDeletionCancelled = "account.deletion_cancelled"
+	AuditAccountDeleted           = "account.deleted"
+	AuditAccountLocked            = "account.locked"
+	AuditAccountUnlocked          = "account.unlocked"
+	AuditRoleCreated              = "role.created"
+	AuditRoleUpdated              = "role.updated"
+	AuditRoleDeleted              = "role.deleted"
+	AuditRoleAssigned             = "role.assigned"
+	AuditRoleUnassigned           = "role.unassigned"
+	AuditSessionsRevokedByAdmin   = "sessions.revoked_by_admin"
+	AuditPasswordResetForced      = "password.reset_forced"
+)
+
+const mailTimeout = 30 * time.Second
+
+// audit records a security event for the user. Failures are logged and never
+// fail the request that triggered the event.
+func (ac *AuthController) audit(c *gin.Context, userID pgtype.UUID, eventType string, metadata gin.H) {
+	var raw []byte
+	if metadata != nil {
+		var err error
+		if raw, err = json.Marshal(metadata); err != nil {
+			log.Printf("Failed to encode audit metadata for %s: %v", eventType, err)
+		}
+	}
+
+	err := ac.db.CreateAuditEvent(c.Request.Context(), generated.CreateAuditEventParams{
+		UserID:    userID,
+		EventType: eventType,
+		IpAddress: pgtype.Text{String: c.ClientIP(), Valid: true},
+		UserAgent: pgtype.Text{String: c.Request.UserAgent(), Valid: true},
+		Metadata:  raw,
+	})
+	if err != nil {
+		log.Printf("Failed to record audit event %s for user %v: %v", eventType, userID, err)
+	}
+}
+
+// notify emails the user in the background so a slow mail server never
+// holds up the response.
+func (ac *AuthController) notify(to, subject, body string) {
+	msg := mailer.Message{To: to, Subject: subject, Body: body}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := ac.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q to %s: %v", subject, to, err)
+		}
+	}()
+}
@@ -1,11 +1,49 @@
 package auth
 
-import generated "auth-service/src/db/generated"
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"auth-service/src/config"
+	generated "auth-service/src/db/generated"
+	"auth-service/src/lockout"
+	"auth-service/src/mailer"
+	"auth-service/src/password"
+)
+
+// txBeginner is the part of the pool withTx needs
+type txBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
 
 type AuthController struct {
-	db *generated.Queries
+	pool      txBeginner
+	db        *generated.Queries
+	cfg       *config.Config
+	mailer    mailer.Mailer
+	passwords *password.Policy
+	hasher    *password.Hasher
+	lockout   *lockout.Guard
+}
+
+func NewAuthController(pool *pgxpool.Pool, cfg *config.Config, mail mailer.Mailer, passwords *password.Policy, hasher *password.Hasher) *AuthController {
+	db := generated.New(pool)
+	return &AuthController{
+		pool:      pool,
+		db:        db,
+		cfg:       cfg,
+		mailer:    mail,
+		passwords: passwords,
+		hasher:    hasher,
+		lockout:   lockout.NewGuard(lockout.NewPostgresStore(db), cfg.Lockout),
+	}
 }
 
-func NewAuthController(db *generated.Queries) *AuthController {
-	return &AuthController{db: db}
+// withTx runs fn in a transaction, committing only when it returns nil
+func (ac *AuthController) withTx(ctx context.Context, fn func(q *generated.Queries) error) error {
+	return pgx.BeginFunc(ctx, ac.pool, func(tx pgx.Tx) error {
+		return fn(ac.db.WithTx(tx))
+	})
 }
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-service/src/config"
+	generated "auth-service/src/db/generated"
+	"auth-service/src/password"
+	jwt "auth-service/src/utils"
+)
+
+// queryFunc answers one sqlc query given its arguments. Each row lists the
+// column values in the order the generated code scans them; a statement run
+// through Exec reports as many affected rows as are returned.
+type queryFunc func(args []any) ([][]any, error)
+
+// fakeCall is a query the code under test ran
+type fakeCall struct {
+	name string
+	args []any
+}
+
+// fakeDB stands in for Postgres behind generated.Queries. Queries are told
+// apart by their sqlc name; any query without a handler fails the test.
+type fakeDB struct {
+	t        *testing.T
+	handlers map[string]queryFunc
+	calls    []fakeCall
+}
+
+var queryName = regexp.MustCompile(`^-- name: (\w+)`)
+
+func newFakeDB(t *testing.T) *fakeDB {
+	return &fakeDB{t: t, handlers: map[string]queryFunc{}}
+}
+
+// on registers the handler for the named query
+func (f *fakeDB) on(name string, fn queryFunc) {
+	f.handlers[name] = fn
+}
+
+// called returns the arguments of every call to the named query
+func (f *fakeDB) called(name string) [][]any {
+	var args [][]any
+	for _, call := range f.calls {
+		if call.name == name {
+			args = append(args, call.args)
+		}
+	}
+	return args
+}
+
+func (f *fakeDB) run(sql string, args []any) ([][]any, error) {
+	m := queryName.FindStringSubmatch(sql)
+	if m == nil {
+		f.t.Errorf("query without a sqlc name: %s", sql)
+		return nil, fmt.Errorf("unnamed query")
+	}
+	f.calls = append(f.calls, fakeCall{name: m[1], args: args})
+
+	fn, ok := f.handlers[m[1]]
+	if !ok {
+		f.t.Errorf("unexpected query %s", m[1])
+		return nil, fmt.Errorf("no handler for %s", m[1])
+	}
+	return fn(args)
+}
+
+func (f *fakeDB) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	rows, err := f.run(sql, args)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", len(rows))), nil
+}
+
+func (f *fakeDB) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := f.run(sql, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{rows: rows, next: -1}, nil
+}
+
+func (f *fakeDB) QueryRow(_ context.Context, sql string, args ...any) pgx.Row {
+	rows, err := f.run(sql, args)
+	if err == nil && len(rows) == 0 {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		return fakeRow{err: err}
+	}
+	return fakeRow{values: rows[0]}
+}
+
+// Begin starts a transaction on the same data. BEGIN, COMMIT and ROLLBACK
+// show up in the call log like queries do.
+func (f *fakeDB) Begin(context.Context) (pgx.Tx, error) {
+	f.calls = append(f.calls, fakeCall{name: "BEGIN"})
+	return &fakeTx{db: f}, nil
+}
+
+// fakeTx runs statements on its fakeDB; only what withTx uses is implemented
+type fakeTx struct {
+	pgx.Tx
+	db     *fakeDB
+	closed bool
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	return tx.end("COMMIT")
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	return tx.end("ROLLBACK")
+}
+
+func (tx *fakeTx) end(name string) error {
+	if tx.closed {
+		return pgx.ErrTxClosed
+	}
+	tx.closed = true
+	tx.db.calls = append(tx.db.calls, fakeCall{name: name})
+	return nil
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return tx.db.Query(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+// callNames lists the queries run so far, in order
+func (f *fakeDB) callNames() []string {
+	names := make([]string, len(f.calls))
+	for i, call := range f.calls {
+		names[i] = call.name
+	}
+	return names
+}
+
+// row flattens structs into their fields, which is the order sqlc scans
+// them in, and passes every other value through
+func row(values ...any) []any {
+	var out []any
+	for _, v := range values {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Struct || rv.Type().PkgPath() != reflect.TypeFor[generated.User]().PkgPath() {
+			out = append(out, v)
+			continue
+		}
+		for i := range rv.NumField() {
+			out = append(out, rv.Field(i).Interface())
+		}
+	}
+	return out
+}
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanValues(r.values, dest)
+}
+
+type fakeRows struct {
+	rows [][]any
+	next int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.NewCommandTag("SELECT") }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *fakeRows) Next() bool {
+	r.next++
+	return r.next < len(r.rows)
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	return scanValues(r.rows[r.next], dest)
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	return r.rows[r.next], nil
+}
+
+func scanValues(values, dest []any) error {
+	if len(values) != len(dest) {
+		return fmt.Errorf("scanning %d values into %d targets", len(values), len(dest))
+	}
+	for i, d := range dest {
+		target := reflect.ValueOf(d).Elem()
+		if values[i] == nil {
+			target.SetZero()
+			continue
+		}
+		v := reflect.ValueOf(values[i])
+		if !v.Type().AssignableTo(target.Type()) {
+			return fmt.Errorf("column %d: cannot scan %T into %s", i, values[i], target.Type())
+		}
+		target.Set(v)
+	}
+	return nil
+}
+
+func newUUID() pgtype.UUID {
+	return pgtype.UUID{Bytes: uuid.New(), Valid: true}
+}
+
+var initKeysOnce sync.Once
+
+// newTestController wires a controller to the fake database with settings
+// that keep tests fast: bcrypt at its minimum cost and an ephemeral key
+func newTestController(t *testing.T, db *fakeDB) *AuthController {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	initKeysOnce.Do(func() {
+		if err := jwt.InitKeys(config.JWTConfig{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	hasher, err := password.NewHasher(config.PasswordHashConfig{
+		Algorithm:  password.AlgorithmBcrypt,
+		BcryptCost: int32(bcrypt.MinCost),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &AuthController{
+		pool: db,
+		db:   generated.New(db),
+		cfg: &config.Config{
+			Cookie:            config.CookieConfig{SameSite: "strict"},
+			EmailVerification: config.EmailVerificationConfig{Policy: config.UnverifiedAllow},
+		},
+		hasher: hasher,
+	}
+}
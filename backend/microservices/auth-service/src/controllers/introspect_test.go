@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	generated "auth-service/src/db/generated"
+	jwt "auth-service/src/utils"
+)
+
+func TestIntrospect(t *testing.T) {
+	db := newFakeDB(t)
+	ac := newTestController(t, db)
+	userID := newUUID()
+	session := generated.Session{ID: newUUID(), UserID: userID}
+
+	access, err := jwt.GenerateAccessToken(userID, "ada@example.com", session.ID, jwt.Authorization{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedOut, err := jwt.GenerateRefreshToken(userID, "ada@example.com", session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := jwt.GenerateRefreshToken(userID, "ada@example.com", session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.RefreshTokenHash = hashedToken(current)
+
+	db.on("GetActiveSession", func(args []any) ([][]any, error) {
+		if args[0] != session.ID || args[1] != session.UserID {
+			return nil, nil
+		}
+		return [][]any{row(session)}, nil
+	})
+	db.on("GetUserRoleNames", func(args []any) ([][]any, error) {
+		return [][]any{{"user"}}, nil
+	})
+	db.on("GetUserPermissions", func(args []any) ([][]any, error) {
+		return [][]any{{"analytics:read"}}, nil
+	})
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		active   bool
+	}{
+		{"access token at another service", access, jwt.AudienceIngest, true},
+		{"access token at the auth service", access, jwt.AudienceAuth, true},
+		{"current refresh token", current, jwt.AudienceAuth, true},
+		{"rotated-out refresh token", rotatedOut, jwt.AudienceAuth, false},
+		{"refresh token at another service", current, jwt.AudienceIngest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			body, _ := json.Marshal(IntrospectRequest{Token: tt.token, Audience: tt.audience})
+			c.Request = httptest.NewRequest(http.MethodPost, "/introspect", bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			ac.Introspect(c)
+
+			var resp IntrospectResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if resp.Active != tt.active {
+				t.Fatalf("active %v, want %v", resp.Active, tt.active)
+			}
+			if resp.Active && resp.Subject != userID.String() {
+				t.Errorf("sub %q, want %s", resp.Subject, userID.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/security"
+	jwt "auth-service/src/utils"
+)
+
+// refreshFixture is one logged-in session whose refresh token the test holds
+type refreshFixture struct {
+	t       *testing.T
+	db      *fakeDB
+	ac      *AuthController
+	user    generated.User
+	session generated.Session
+	token   string
+}
+
+func newRefreshFixture(t *testing.T) *refreshFixture {
+	t.Helper()
+	db := newFakeDB(t)
+	f := &refreshFixture{
+		t:    t,
+		db:   db,
+		ac:   newTestController(t, db),
+		user: generated.User{ID: newUUID(), Email: "ada@example.com", EmailVerified: true},
+	}
+
+	f.session = generated.Session{ID: newUUID(), UserID: f.user.ID}
+	token, err := jwt.GenerateRefreshToken(f.user.ID, f.user.Email, f.session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.token = token
+	f.session.RefreshTokenHash = hashedToken(token)
+
+	db.on("GetSessionByRefreshTokenHash", func(args []any) ([][]any, error) {
+		if args[0] != f.session.RefreshTokenHash {
+			return nil, nil
+		}
+		return [][]any{row(f.session)}, nil
+	})
+	db.on("RotateSessionToken", func(args []any) ([][]any, error) {
+		if args[2] != f.session.ID || args[3] != f.session.RefreshTokenHash || f.session.RevokedAt.Valid {
+			return nil, nil
+		}
+		f.session.RefreshTokenHash = args[0].(pgtype.Text)
+		f.session.ExpiresAt = args[1].(pgtype.Timestamp)
+		return [][]any{row(f.session)}, nil
+	})
+	db.on("RevokeSession", func(args []any) ([][]any, error) {
+		if args[0] != f.session.ID || args[1] != f.session.UserID || f.session.RevokedAt.Valid {
+			return nil, nil
+		}
+		f.session.RevokedAt = pgtype.Timestamp{Time: time.Now(), Valid: true}
+		return [][]any{{}}, nil
+	})
+	db.on("GetUserByID", func(args []any) ([][]any, error) {
+		return [][]any{row(f.user)}, nil
+	})
+	db.on("GetUserRoleNames", func(args []any) ([][]any, error) {
+		return [][]any{{"user"}}, nil
+	})
+	db.on("GetUserPermissions", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+	return f
+}
+
+// refresh presents token in the refresh_token cookie and returns the
+// response and the refresh token handed out, if any
+func (f *refreshFixture) refresh(token string) (*httptest.ResponseRecorder, string) {
+	f.t.Helper()
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	if token != "" {
+		c.Request.AddCookie(&http.Cookie{Name: "refresh_token", Value: token})
+	}
+	f.ac.Refresh(c)
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "refresh_token" {
+			return rec, cookie.Value
+		}
+	}
+	return rec, ""
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	f := newRefreshFixture(t)
+
+	token := f.token
+	for i := range 3 {
+		rec, next := f.refresh(token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("refresh %d: status %d: %s", i+1, rec.Code, rec.Body)
+		}
+		if next == "" || next == token {
+			t.Fatalf("refresh %d: token was not rotated", i+1)
+		}
+		if f.session.RefreshTokenHash.String != security.HashToken(next) {
+			t.Fatalf("refresh %d: session does not hold the new token", i+1)
+		}
+
+		claims, err := jwt.ValidateToken(next, jwt.AudienceAuth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Type != "refresh" || claims.SessionID != f.session.ID {
+			t.Errorf("refresh %d: claims %+v, want a refresh token for the same session", i+1, claims)
+		}
+		token = next
+	}
+	if f.session.RevokedAt.Valid {
+		t.Error("session was revoked")
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	f := newRefreshFixture(t)
+
+	rec, current := f.refresh(f.token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	// Presenting the rotated-out token again means two parties hold the family
+	rec, _ = f.refresh(f.token)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "reuse detected") {
+		t.Fatalf("replayed token: status %d: %s", rec.Code, rec.Body)
+	}
+	if !f.session.RevokedAt.Valid {
+		t.Fatal("session was not revoked")
+	}
+
+	// So the legitimate holder is logged out as well
+	if rec, _ := f.refresh(current); rec.Code != http.StatusUnauthorized {
+		t.Errorf("current token after reuse: status %d, want 401", rec.Code)
+	}
+}
+
+func TestRefreshLosingRotationRaceRevokesSession(t *testing.T) {
+	f := newRefreshFixture(t)
+
+	// Another request rotates the token between lookup and update
+	f.db.on("RotateSessionToken", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+
+	rec, next := f.refresh(f.token)
+	if rec.Code != http.StatusUnauthorized || next != "" {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if !f.session.RevokedAt.Valid {
+		t.Error("session was not revoked")
+	}
+}
+
+func TestRefreshRejectsOtherTokens(t *testing.T) {
+	f := newRefreshFixture(t)
+	access, err := jwt.GenerateAccessToken(f.user.ID, f.user.Email, f.session.ID, jwt.Authorization{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"no token", ""},
+		{"access token", access},
+		{"garbage", "not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec, _ := f.refresh(tt.token); rec.Code != http.StatusUnauthorized {
+				t.Errorf("status %d, want 401", rec.Code)
+			}
+		})
+	}
+	if f.db.called("GetSessionByRefreshTokenHash") != nil || f.session.RevokedAt.Valid {
+		t.Error("invalid token reached the session store")
+	}
+}
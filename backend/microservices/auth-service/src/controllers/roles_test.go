@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+	"auth-service/src/rbac"
+)
+
+// rolesFixture holds the admin and user roles and who has them
+type rolesFixture struct {
+	db      *fakeDB
+	ac      *AuthController
+	roles   map[string]generated.Role
+	members map[string][]pgtype.UUID // by role name
+	leaving []pgtype.UUID            // accounts scheduled for deletion
+}
+
+func newRolesFixture(t *testing.T) *rolesFixture {
+	db := newFakeDB(t)
+	f := &rolesFixture{
+		db: db,
+		ac: newTestController(t, db),
+		roles: map[string]generated.Role{
+			rbac.RoleAdmin: {ID: newUUID(), Name: rbac.RoleAdmin},
+			rbac.RoleUser:  {ID: newUUID(), Name: rbac.RoleUser},
+		},
+		members: map[string][]pgtype.UUID{},
+	}
+
+	roleByID := func(id any) string {
+		for name, role := range f.roles {
+			if role.ID == id {
+				return name
+			}
+		}
+		t.Fatalf("unknown role id %v", id)
+		return ""
+	}
+
+	db.on("FindRoleByName", func(args []any) ([][]any, error) {
+		role, ok := f.roles[args[0].(string)]
+		if !ok {
+			return nil, nil
+		}
+		return [][]any{row(role)}, nil
+	})
+	db.on("LockRole", func(args []any) ([][]any, error) {
+		return [][]any{{}}, nil
+	})
+	db.on("DeleteUserRole", func(args []any) ([][]any, error) {
+		name := roleByID(args[1])
+		before := len(f.members[name])
+		f.members[name] = slices.DeleteFunc(f.members[name], func(id pgtype.UUID) bool { return id == args[0] })
+		if len(f.members[name]) == before {
+			return nil, nil
+		}
+		return [][]any{{}}, nil
+	})
+	db.on("CountActiveRoleMembers", func(args []any) ([][]any, error) {
+		var count int64
+		for _, id := range f.members[roleByID(args[0])] {
+			if !slices.Contains(f.leaving, id) {
+				count++
+			}
+		}
+		return [][]any{{count}}, nil
+	})
+	db.on("CreateAuditEvent", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+	db.on("GetUserRoleNames", func(args []any) ([][]any, error) {
+		var rows [][]any
+		for _, name := range []string{rbac.RoleAdmin, rbac.RoleUser} {
+			if slices.Contains(f.members[name], args[0].(pgtype.UUID)) {
+				rows = append(rows, []any{name})
+			}
+		}
+		return rows, nil
+	})
+	return f
+}
+
+// unassign has actor remove role from the user with the given id
+func (f *rolesFixture) unassign(actor pgtype.UUID, id, role string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/admin/users/"+id+"/roles/"+role, nil)
+	c.Params = gin.Params{{Key: "id", Value: id}, {Key: "role", Value: role}}
+	c.Set("user_id", actor)
+	f.ac.UnassignRole(c)
+	return rec
+}
+
+func TestUnassignRole(t *testing.T) {
+	alice, bob := newUUID(), newUUID()
+
+	tests := []struct {
+		name       string
+		admins     []pgtype.UUID
+		leaving    []pgtype.UUID
+		target     pgtype.UUID
+		role       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"one of two admins", []pgtype.UUID{alice, bob}, nil, bob, rbac.RoleAdmin, http.StatusOK, `"roles":["user"]`},
+		{"last admin demotes themselves", []pgtype.UUID{alice}, nil, alice, rbac.RoleAdmin, http.StatusConflict, `"error_code":"last_admin"`},
+		{"only other admin is leaving", []pgtype.UUID{alice, bob}, []pgtype.UUID{bob}, alice, rbac.RoleAdmin, http.StatusConflict, `"error_code":"last_admin"`},
+		{"leaving admin may go", []pgtype.UUID{alice, bob}, []pgtype.UUID{bob}, bob, rbac.RoleAdmin, http.StatusOK, `"roles":["user"]`},
+		{"other roles have no floor", []pgtype.UUID{alice}, nil, bob, rbac.RoleUser, http.StatusOK, `"roles":[]`},
+		{"role not held", []pgtype.UUID{alice}, nil, bob, rbac.RoleAdmin, http.StatusNotFound, "does not have this role"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newRolesFixture(t)
+			f.members[rbac.RoleAdmin] = slices.Clone(tt.admins)
+			f.members[rbac.RoleUser] = []pgtype.UUID{alice, bob}
+			f.leaving = tt.leaving
+
+			rec := f.unassign(alice, tt.target.String(), tt.role)
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("status %d, body %s; want %d with %s", rec.Code, rec.Body, tt.wantStatus, tt.wantBody)
+			}
+
+			// The admin role is locked before anything changes, and a refused
+			// removal is rolled back without an audit entry
+			calls := f.db.callNames()
+			if locked := slices.Index(calls, "LockRole"); (locked >= 0) != (tt.role == rbac.RoleAdmin) ||
+				(locked >= 0 && locked > slices.Index(calls, "DeleteUserRole")) {
+				t.Errorf("calls %v: admin role not locked first", calls)
+			}
+			ok := tt.wantStatus == http.StatusOK
+			if slices.Contains(calls, "COMMIT") != ok || slices.Contains(calls, "CreateAuditEvent") != ok {
+				t.Errorf("calls %v: want commit and audit only on success", calls)
+			}
+			if !ok && !slices.Contains(calls, "ROLLBACK") {
+				t.Errorf("calls %v: not rolled back", calls)
+			}
+		})
+	}
+}
+
+func TestUnassignRoleBadRequest(t *testing.T) {
+	f := newRolesFixture(t)
+	actor := newUUID()
+
+	if rec := f.unassign(actor, "not-a-uuid", rbac.RoleAdmin); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad id: status %d, want 400", rec.Code)
+	}
+	if rec := f.unassign(actor, actor.String(), "superuser"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown role: status %d, want 404", rec.Code)
+	}
+	if slices.Contains(f.db.callNames(), "BEGIN") {
+		t.Error("transaction started for a request that was refused up front")
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	jwt "auth-service/src/utils"
+)
+
+// Login, register and refresh hand out tokens either as HttpOnly cookies
+// (the default, for browsers) or in the JSON body for native apps, CLIs and
+// devices that cannot keep cookies. Clients pick with ?token_delivery=body;
+// body-mode clients then send the access token as "Authorization: Bearer".
+const (
+	TokenDeliveryCookie = "cookie"
+	TokenDeliveryBody   = "body"
+)
+
+// tokensInBody reports whether the caller asked for tokens in the response body
+func tokensInBody(c *gin.Context) (bool, error) {
+	switch mode := c.DefaultQuery("token_delivery", TokenDeliveryCookie); mode {
+	case TokenDeliveryCookie:
+		return false, nil
+	case TokenDeliveryBody:
+		return true, nil
+	default:
+		return false, fmt.Errorf("token_delivery must be %q or %q", TokenDeliveryCookie, TokenDeliveryBody)
+	}
+}
+
+// deliverTokens sets the token pair as cookies, or adds it to the response
+// body in the shape of an OAuth 2.0 token response (RFC 6749 §5.1).
+func (ac *AuthController) deliverTokens(c *gin.Context, resp gin.H, inBody bool, accessToken, refreshToken string, sameSite http.SameSite) {
+	if !inBody {
+		ac.setAuthCookies(c, accessToken, refreshToken, sameSite)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	resp["access_token"] = accessToken
+	resp["refresh_token"] = refreshToken
+	resp["token_type"] = "Bearer"
+	resp["expires_in"] = int(jwt.AccessTokenDuration.Seconds())
+}
+
+// setAuthCookies hands the token pair to the browser as HttpOnly cookies
+func (ac *AuthController) setAuthCookies(c *gin.Context, accessToken, refreshToken string, sameSite http.SameSite) {
+	c.SetSameSite(sameSite)
+	c.SetCookie("access_token", accessToken, int(jwt.AccessTokenDuration.Seconds()), "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
+	c.SetCookie("refresh_token", refreshToken, int(jwt.RefreshTokenDuration.Seconds()), "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
+}
+
+// clearAuthCookies expires both token cookies on the client.
+func (ac *AuthController) clearAuthCookies(c *gin.Context) {
+	c.SetSameSite(ac.cfg.Cookie.SameSiteMode())
+	c.SetCookie("access_token", "", -1, "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
+	c.SetCookie("refresh_token", "", -1, "/", ac.cfg.Cookie.Domain, ac.cfg.Cookie.Secure, true)
+}
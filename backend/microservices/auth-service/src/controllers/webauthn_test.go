@@ -0,0 +1,473 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/descope/virtualwebauthn"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"auth-service/src/config"
+	generated "auth-service/src/db/generated"
+	"auth-service/src/mailer"
+	jwt "auth-service/src/utils"
+)
+
+const testPassword = "correct horse battery staple"
+
+var (
+	testRP  = virtualwebauthn.RelyingParty{ID: "example.com", Name: "Device Monitor", Origin: "https://example.com"}
+	phishRP = virtualwebauthn.RelyingParty{ID: "example.com", Name: "Device Monitor", Origin: "https://example.com.evil.test"}
+)
+
+// passkeyFixture is one signed-in user with a virtual authenticator, backed
+// by a fake database that keeps ceremonies and credentials in memory
+type passkeyFixture struct {
+	t             *testing.T
+	db            *fakeDB
+	ac            *AuthController
+	user          generated.User
+	session       generated.Session
+	ceremonies    map[pgtype.UUID]generated.WebauthnCeremony
+	credentials   []generated.WebauthnCredential
+	authenticator virtualwebauthn.Authenticator
+}
+
+func newPasskeyFixture(t *testing.T) *passkeyFixture {
+	t.Helper()
+	if err := InitWebAuthn(config.WebAuthnConfig{
+		RPID:          testRP.ID,
+		RPDisplayName: testRP.Name,
+		RPOrigins:     []string{testRP.Origin},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	db := newFakeDB(t)
+	f := &passkeyFixture{
+		t:          t,
+		db:         db,
+		ac:         newTestController(t, db),
+		ceremonies: map[pgtype.UUID]generated.WebauthnCeremony{},
+	}
+
+	hash, err := f.ac.hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := pgtype.Timestamp{Time: time.Now(), Valid: true}
+	f.user = generated.User{
+		ID:            newUUID(),
+		Email:         "ada@example.com",
+		PasswordHash:  pgtype.Text{String: hash, Valid: true},
+		CreatedAt:     now,
+		EmailVerified: true,
+	}
+	f.session = generated.Session{ID: newUUID(), UserID: f.user.ID, CreatedAt: now}
+
+	// The user handle is what ties a discoverable passkey back to the account
+	f.authenticator = virtualwebauthn.NewAuthenticatorWithOptions(virtualwebauthn.AuthenticatorOptions{
+		UserHandle:     f.user.ID.Bytes[:],
+		BackupEligible: true,
+		BackupState:    true,
+	})
+
+	db.on("GetUserByID", func(args []any) ([][]any, error) {
+		return [][]any{row(f.user)}, nil
+	})
+	db.on("GetActiveSession", func(args []any) ([][]any, error) {
+		if args[0] != f.session.ID {
+			return nil, nil
+		}
+		return [][]any{row(f.session)}, nil
+	})
+	db.on("DeleteExpiredWebauthnCeremonies", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+	db.on("CreateWebauthnCeremony", func(args []any) ([][]any, error) {
+		ceremony := generated.WebauthnCeremony{
+			ID:          newUUID(),
+			UserID:      args[0].(pgtype.UUID),
+			Kind:        args[1].(string),
+			SessionData: args[2].([]byte),
+			ExpiresAt:   args[3].(pgtype.Timestamp),
+		}
+		f.ceremonies[ceremony.ID] = ceremony
+		return [][]any{{ceremony.ID}}, nil
+	})
+	db.on("TakeWebauthnCeremony", func(args []any) ([][]any, error) {
+		ceremony, ok := f.ceremonies[args[0].(pgtype.UUID)]
+		if !ok || ceremony.Kind != args[1].(string) {
+			return nil, nil
+		}
+		delete(f.ceremonies, ceremony.ID)
+		return [][]any{row(ceremony)}, nil
+	})
+	db.on("ListWebauthnCredentialsByUser", func(args []any) ([][]any, error) {
+		var rows [][]any
+		for _, cred := range f.credentials {
+			rows = append(rows, row(cred))
+		}
+		return rows, nil
+	})
+	db.on("CreateWebauthnCredential", func(args []any) ([][]any, error) {
+		cred := generated.WebauthnCredential{
+			ID:              newUUID(),
+			UserID:          args[0].(pgtype.UUID),
+			CredentialID:    args[1].([]byte),
+			PublicKey:       args[2].([]byte),
+			AttestationType: args[3].(string),
+			Aaguid:          args[4].([]byte),
+			SignCount:       args[5].(int64),
+			BackupEligible:  args[6].(bool),
+			BackupState:     args[7].(bool),
+			Transports:      args[8].([]string),
+			Attachment:      args[9].(pgtype.Text),
+			Name:            args[10].(pgtype.Text),
+			CreatedAt:       pgtype.Timestamp{Time: time.Now(), Valid: true},
+		}
+		f.credentials = append(f.credentials, cred)
+		return [][]any{row(cred)}, nil
+	})
+	db.on("GetWebauthnCredentialByCredentialID", func(args []any) ([][]any, error) {
+		for _, cred := range f.credentials {
+			if bytes.Equal(cred.CredentialID, args[0].([]byte)) {
+				return [][]any{row(cred)}, nil
+			}
+		}
+		return nil, nil
+	})
+	db.on("UpdateWebauthnCredentialUsage", func(args []any) ([][]any, error) {
+		for i := range f.credentials {
+			if f.credentials[i].ID == args[0] {
+				f.credentials[i].SignCount = args[1].(int64)
+				f.credentials[i].CloneWarning = args[2].(bool)
+				f.credentials[i].BackupState = args[3].(bool)
+				return [][]any{{}}, nil
+			}
+		}
+		return nil, nil
+	})
+
+	// What finishLogin needs to open a session
+	db.on("GetUserRoleNames", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+	db.on("GetUserPermissions", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+	db.on("CreateSession", func(args []any) ([][]any, error) {
+		return [][]any{row(generated.Session{ID: args[0].(pgtype.UUID), UserID: args[1].(pgtype.UUID)})}, nil
+	})
+	db.on("FindDeviceByUserAndIP", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+	db.on("CreateDevice", func(args []any) ([][]any, error) {
+		return [][]any{row(generated.Device{ID: newUUID(), UserID: args[0].(pgtype.UUID)})}, nil
+	})
+	db.on("AttachSessionDevice", func(args []any) ([][]any, error) {
+		return nil, nil
+	})
+	return f
+}
+
+// post runs handler on a JSON request, as the signed-in user if signedIn
+func (f *passkeyFixture) post(handler gin.HandlerFunc, body any, signedIn bool) *httptest.ResponseRecorder {
+	f.t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/?token_delivery=body", bytes.NewReader(raw))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if signedIn {
+		c.Set("user_id", f.user.ID)
+		c.Set("session_id", f.session.ID)
+	}
+	handler(c)
+	return rec
+}
+
+// begin starts a ceremony and returns its id and the options for the browser
+func (f *passkeyFixture) begin(handler gin.HandlerFunc, body any, signedIn bool) (string, string) {
+	f.t.Helper()
+	rec := f.post(handler, body, signedIn)
+	if rec.Code != http.StatusOK {
+		f.t.Fatalf("begin: status %d: %s", rec.Code, rec.Body)
+	}
+	var begun struct {
+		CeremonyID string          `json:"ceremony_id"`
+		Options    json.RawMessage `json:"options"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &begun); err != nil {
+		f.t.Fatal(err)
+	}
+	return begun.CeremonyID, string(begun.Options)
+}
+
+// register creates a new credential on the authenticator and answers a
+// registration ceremony with it as the browser at rp.Origin would
+func (f *passkeyFixture) register(rp virtualwebauthn.RelyingParty) (virtualwebauthn.Credential, *httptest.ResponseRecorder) {
+	f.t.Helper()
+	ceremonyID, options := f.begin(f.ac.BeginPasskeyRegistration, PasskeyRegistrationRequest{Password: testPassword}, true)
+	parsed, err := virtualwebauthn.ParseAttestationOptions(options)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	cred := virtualwebauthn.NewCredential(virtualwebauthn.KeyTypeEC2)
+	attestation := virtualwebauthn.CreateAttestationResponse(rp, f.authenticator, cred, *parsed)
+	rec := f.post(f.ac.FinishPasskeyRegistration, WebAuthnFinishRequest{
+		CeremonyID: ceremonyID,
+		Name:       "Laptop",
+		Credential: json.RawMessage(attestation),
+	}, true)
+	return cred, rec
+}
+
+// login signs in with cred after its counter has moved to counter
+func (f *passkeyFixture) login(rp virtualwebauthn.RelyingParty, cred virtualwebauthn.Credential, counter uint32) *httptest.ResponseRecorder {
+	f.t.Helper()
+	ceremonyID, options := f.begin(f.ac.BeginPasskeyLogin, nil, false)
+	parsed, err := virtualwebauthn.ParseAssertionOptions(options)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+
+	cred.Counter = counter
+	assertion := virtualwebauthn.CreateAssertionResponse(rp, f.authenticator, cred, *parsed)
+	return f.post(f.ac.FinishPasskeyLogin, WebAuthnFinishRequest{
+		CeremonyID: ceremonyID,
+		Credential: json.RawMessage(assertion),
+	}, false)
+}
+
+func TestPasskeyRoundTrip(t *testing.T) {
+	f := newPasskeyFixture(t)
+
+	cred, rec := f.register(testRP)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	var registered struct {
+		Passkey PasskeyResponse `json:"passkey"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &registered); err != nil {
+		t.Fatal(err)
+	}
+	if registered.Passkey.Name != "Laptop" || !registered.Passkey.Synced {
+		t.Errorf("passkey %+v, want a synced passkey named Laptop", registered.Passkey)
+	}
+	if len(f.credentials) != 1 || !bytes.Equal(f.credentials[0].CredentialID, cred.ID) {
+		t.Fatalf("stored credentials %+v", f.credentials)
+	}
+
+	for counter := uint32(1); counter <= 2; counter++ {
+		rec := f.login(testRP, cred, counter)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("login %d: status %d: %s", counter, rec.Code, rec.Body)
+		}
+		var loggedIn struct {
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &loggedIn); err != nil {
+			t.Fatal(err)
+		}
+		claims, err := jwt.ValidateToken(loggedIn.AccessToken, jwt.AudienceAuth)
+		if err != nil {
+			t.Fatalf("login %d: access token: %v", counter, err)
+		}
+		if claims.UserID != f.user.ID {
+			t.Errorf("login %d: token for %v, want %v", counter, claims.UserID, f.user.ID)
+		}
+		if got := f.credentials[0].SignCount; got != int64(counter) {
+			t.Errorf("login %d: stored sign count %d", counter, got)
+		}
+	}
+	if len(f.ceremonies) != 0 {
+		t.Errorf("%d ceremonies left behind", len(f.ceremonies))
+	}
+}
+
+func TestPasskeyCeremonyIsAnsweredOnce(t *testing.T) {
+	f := newPasskeyFixture(t)
+	cred, rec := f.register(testRP)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+
+	ceremonyID, options := f.begin(f.ac.BeginPasskeyLogin, nil, false)
+	parsed, err := virtualwebauthn.ParseAssertionOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred.Counter = 1
+	finish := WebAuthnFinishRequest{
+		CeremonyID: ceremonyID,
+		Credential: json.RawMessage(virtualwebauthn.CreateAssertionResponse(testRP, f.authenticator, cred, *parsed)),
+	}
+
+	if rec := f.post(f.ac.FinishPasskeyLogin, finish, false); rec.Code != http.StatusOK {
+		t.Fatalf("first answer: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := f.post(f.ac.FinishPasskeyLogin, finish, false); rec.Code != http.StatusBadRequest {
+		t.Errorf("replayed answer: status %d, want 400", rec.Code)
+	}
+}
+
+func TestPasskeyRegistrationRequiresReauthentication(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		oauthOnly bool
+		signedIn  time.Duration // how long ago the session started
+		want      int
+		wantCode  string
+	}{
+		{"right password", testPassword, false, time.Hour, http.StatusOK, ""},
+		{"wrong password", "not the password", false, 0, http.StatusUnauthorized, ""},
+		{"no password", "", false, 0, http.StatusUnauthorized, ""},
+		{"oauth account, recent login", "", true, time.Minute, http.StatusOK, ""},
+		{"oauth account, old login", "", true, time.Hour, http.StatusUnauthorized, "reauthentication_required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPasskeyFixture(t)
+			if tt.oauthOnly {
+				f.user.PasswordHash = pgtype.Text{}
+				f.user.OauthProvider = pgtype.Text{String: "google", Valid: true}
+			}
+			f.session.CreatedAt.Time = time.Now().Add(-tt.signedIn)
+
+			rec := f.post(f.ac.BeginPasskeyRegistration, PasskeyRegistrationRequest{Password: tt.password}, true)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			var body struct {
+				ErrorCode string `json:"error_code"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.ErrorCode != tt.wantCode {
+				t.Errorf("error_code %q, want %q", body.ErrorCode, tt.wantCode)
+			}
+			if started := len(f.ceremonies) == 1; started != (tt.want == http.StatusOK) {
+				t.Errorf("ceremony started: %v", started)
+			}
+		})
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	f := newPasskeyFixture(t)
+	cred, rec := f.register(testRP)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := f.login(testRP, cred, 10); rec.Code != http.StatusOK {
+		t.Fatalf("login at 10: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// A counter going backwards means another copy of the key is in use
+	if rec := f.login(testRP, cred, 5); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login at 5: status %d, want 401", rec.Code)
+	}
+	if !f.credentials[0].CloneWarning {
+		t.Error("clone warning was not stored")
+	}
+	if got := f.credentials[0].SignCount; got != 10 {
+		t.Errorf("stored sign count %d, want 10", got)
+	}
+	if sessions := len(f.db.called("CreateSession")); sessions != 1 {
+		t.Errorf("%d sessions created, want only the first login's", sessions)
+	}
+}
+
+func TestPasskeyWrongOrigin(t *testing.T) {
+	t.Run("registration", func(t *testing.T) {
+		f := newPasskeyFixture(t)
+		if _, rec := f.register(phishRP); rec.Code != http.StatusBadRequest {
+			t.Errorf("status %d, want 400", rec.Code)
+		}
+		if len(f.credentials) != 0 {
+			t.Error("passkey was stored")
+		}
+	})
+
+	t.Run("login", func(t *testing.T) {
+		f := newPasskeyFixture(t)
+		cred, rec := f.register(testRP)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+		}
+		if rec := f.login(phishRP, cred, 1); rec.Code != http.StatusUnauthorized {
+			t.Errorf("status %d, want 401", rec.Code)
+		}
+		if f.db.called("CreateSession") != nil {
+			t.Error("session was created")
+		}
+	})
+}
+
+func TestDeletePasskeyRequiresReauthentication(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{"right password", testPassword, http.StatusOK},
+		{"wrong password", "not the password", http.StatusUnauthorized},
+		{"no password", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newPasskeyFixture(t)
+			f.ac.mailer = mailer.LogMailer{}
+			if _, rec := f.register(testRP); rec.Code != http.StatusCreated {
+				t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+			}
+			f.db.on("DeleteWebauthnCredential", func(args []any) ([][]any, error) {
+				for i, cred := range f.credentials {
+					if cred.ID == args[0] && cred.UserID == args[1] {
+						f.credentials = slices.Delete(f.credentials, i, i+1)
+						return [][]any{{}}, nil
+					}
+				}
+				return nil, nil
+			})
+			f.db.on("CreateAuditEvent", func(args []any) ([][]any, error) {
+				return nil, nil
+			})
+
+			raw, _ := json.Marshal(DeletePasskeyRequest{Password: tt.password})
+			rec := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(rec)
+			c.Request = httptest.NewRequest(http.MethodDelete, "/webauthn/credentials/"+f.credentials[0].ID.String(), bytes.NewReader(raw))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = gin.Params{{Key: "id", Value: f.credentials[0].ID.String()}}
+			c.Set("user_id", f.user.ID)
+			c.Set("session_id", f.session.ID)
+			f.ac.DeletePasskey(c)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			ok := tt.want == http.StatusOK
+			if deleted := len(f.credentials) == 0; deleted != ok {
+				t.Errorf("passkey deleted: %v", deleted)
+			}
+			if audited := f.db.called("CreateAuditEvent") != nil; audited != ok {
+				t.Errorf("audited: %v", audited)
+			}
+		})
+	}
+}
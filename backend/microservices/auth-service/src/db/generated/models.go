@@ -8,6 +8,16 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuditEvent struct {
+	ID        pgtype.UUID      `json:"id"`
+	UserID    pgtype.UUID      `json:"user_id"`
+	EventType string           `json:"event_type"`
+	IpAddress pgtype.Text      `json:"ip_address"`
+	UserAgent pgtype.Text      `json:"user_agent"`
+	Metadata  []byte           `json:"metadata"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
 type Device struct {
 	ID         pgtype.UUID      `json:"id"`
 	UserID     pgtype.UUID      `json:"user_id"`
@@ -18,6 +28,66 @@ type Device struct {
 	CreatedAt  pgtype.Timestamp `json:"created_at"`
 }
 
+type LoginThrottle struct {
+	Key           string           `json:"key"`
+	Failures      int32            `json:"failures"`
+	LastFailureAt pgtype.Timestamp `json:"last_failure_at"`
+	BlockedUntil  pgtype.Timestamp `json:"blocked_until"`
+	LockedAt      pgtype.Timestamp `json:"locked_at"`
+}
+
+type MfaChallenge struct {
+	ID         pgtype.UUID      `json:"id"`
+	UserID     pgtype.UUID      `json:"user_id"`
+	TokenHash  string           `json:"token_hash"`
+	Attempts   int32            `json:"attempts"`
+	ExpiresAt  pgtype.Timestamp `json:"expires_at"`
+	ConsumedAt pgtype.Timestamp `json:"consumed_at"`
+	CreatedAt  pgtype.Timestamp `json:"created_at"`
+}
+
+type MfaRecoveryCode struct {
+	ID        pgtype.UUID      `json:"id"`
+	UserID    pgtype.UUID      `json:"user_id"`
+	CodeHash  string           `json:"code_hash"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type MfaTotp struct {
+	UserID          pgtype.UUID      `json:"user_id"`
+	SecretEncrypted []byte           `json:"secret_encrypted"`
+	ConfirmedAt     pgtype.Timestamp `json:"confirmed_at"`
+	LastUsedStep    pgtype.Int8      `json:"last_used_step"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+}
+
+type OutboxEvent struct {
+	ID           pgtype.UUID      `json:"id"`
+	EventType    string           `json:"event_type"`
+	Payload      []byte           `json:"payload"`
+	Attempts     int32            `json:"attempts"`
+	CreatedAt    pgtype.Timestamp `json:"created_at"`
+	PublishedAt  pgtype.Timestamp `json:"published_at"`
+	ClaimedUntil pgtype.Timestamp `json:"claimed_until"`
+}
+
+type PasswordResetToken struct {
+	ID        pgtype.UUID      `json:"id"`
+	UserID    pgtype.UUID      `json:"user_id"`
+	TokenHash string           `json:"token_hash"`
+	ExpiresAt pgtype.Timestamp `json:"expires_at"`
+	UsedAt    pgtype.Timestamp `json:"used_at"`
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+}
+
+type Permission struct {
+	ID          pgtype.UUID      `json:"id"`
+	Name        string           `json:"name"`
+	Description pgtype.Text      `json:"description"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+}
+
 type Role struct {
 	ID          pgtype.UUID      `json:"id"`
 	Name        string           `json:"name"`
@@ -25,25 +95,40 @@ type Role struct {
 	CreatedAt   pgtype.Timestamp `json:"created_at"`
 }
 
+type RolePermission struct {
+	RoleID       pgtype.UUID      `json:"role_id"`
+	PermissionID pgtype.UUID      `json:"permission_id"`
+	GrantedAt    pgtype.Timestamp `json:"granted_at"`
+}
+
 type Session struct {
-	ID           pgtype.UUID      `json:"id"`
-	UserID       pgtype.UUID      `json:"user_id"`
-	RefreshToken string           `json:"refresh_token"`
-	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
-	CreatedAt    pgtype.Timestamp `json:"created_at"`
-	UpdatedAt    pgtype.Timestamp `json:"updated_at"`
+	ID               pgtype.UUID      `json:"id"`
+	UserID           pgtype.UUID      `json:"user_id"`
+	RefreshToken     pgtype.Text      `json:"refresh_token"`
+	ExpiresAt        pgtype.Timestamp `json:"expires_at"`
+	CreatedAt        pgtype.Timestamp `json:"created_at"`
+	UpdatedAt        pgtype.Timestamp `json:"updated_at"`
+	RevokedAt        pgtype.Timestamp `json:"revoked_at"`
+	RefreshTokenHash pgtype.Text      `json:"refresh_token_hash"`
+	DeviceID         pgtype.UUID      `json:"device_id"`
 }
 
 type User struct {
-	ID              pgtype.UUID      `json:"id"`
-	Email           string           `json:"email"`
-	PasswordHash    pgtype.Text      `json:"password_hash"`
-	OauthProvider   pgtype.Text      `json:"oauth_provider"`
-	OauthProviderID pgtype.Text      `json:"oauth_provider_id"`
-	MfaEnabled      pgtype.Bool      `json:"mfa_enabled"`
-	RiskScore       pgtype.Int4      `json:"risk_score"`
-	CreatedAt       pgtype.Timestamp `json:"created_at"`
-	UpdatedAt       pgtype.Timestamp `json:"updated_at"`
+	ID                   pgtype.UUID      `json:"id"`
+	Email                string           `json:"email"`
+	PasswordHash         pgtype.Text      `json:"password_hash"`
+	OauthProvider        pgtype.Text      `json:"oauth_provider"`
+	OauthProviderID      pgtype.Text      `json:"oauth_provider_id"`
+	MfaEnabled           pgtype.Bool      `json:"mfa_enabled"`
+	RiskScore            pgtype.Int4      `json:"risk_score"`
+	CreatedAt            pgtype.Timestamp `json:"created_at"`
+	UpdatedAt            pgtype.Timestamp `json:"updated_at"`
+	EmailVerified        bool             `json:"email_verified"`
+	EmailVerifiedAt      pgtype.Timestamp `json:"email_verified_at"`
+	VerificationSentAt   pgtype.Timestamp `json:"verification_sent_at"`
+	DeletionRequestedAt  pgtype.Timestamp `json:"deletion_requested_at"`
+	DeletionScheduledFor pgtype.Timestamp `json:"deletion_scheduled_for"`
+	DeletedAt            pgtype.Timestamp `json:"deleted_at"`
 }
 
 type UserRole struct {
@@ -52,3 +137,30 @@ type UserRole struct {
 	RoleID     pgtype.UUID      `json:"role_id"`
 	AssignedAt pgtype.Timestamp `json:"assigned_at"`
 }
+
+type WebauthnCeremony struct {
+	ID          pgtype.UUID      `json:"id"`
+	UserID      pgtype.UUID      `json:"user_id"`
+	Kind        string           `json:"kind"`
+	SessionData []byte           `json:"session_data"`
+	ExpiresAt   pgtype.Timestamp `json:"expires_at"`
+	CreatedAt   pgtype.Timestamp `json:"created_at"`
+}
+
+type WebauthnCredential struct {
+	ID              pgtype.UUID      `json:"id"`
+	UserID          pgtype.UUID      `json:"user_id"`
+	CredentialID    []byte           `json:"credential_id"`
+	PublicKey       []byte           `json:"public_key"`
+	AttestationType string           `json:"attestation_type"`
+	Aaguid          []byte           `json:"aaguid"`
+	SignCount       int64            `json:"sign_count"`
+	CloneWarning    bool             `json:"clone_warning"`
+	BackupEligible  bool             `json:"backup_eligible"`
+	BackupState     bool             `json:"backup_state"`
+	Transports      []string         `json:"transports"`
+	Attachment      pgtype.Text      `json:"attachment"`
+	Name            pgtype.Text      `json:"name"`
+	CreatedAt       pgtype.Timestamp `json:"created_at"`
+	LastUsedAt      pgtype.Timestamp `json:"last_used_at"`
+}
@@ -11,17 +11,121 @@ import (
 )
 
 type Querier interface {
+	// Removes everything that identifies the person but keeps the row, so IDs
+	// other services still hold keep pointing at a (deleted) user.
+	AnonymizeUser(ctx context.Context, userID pgtype.UUID) error
+	AttachSessionDevice(ctx context.Context, arg AttachSessionDeviceParams) error
+	BlockLogin(ctx context.Context, arg BlockLoginParams) error
+	CancelUserDeletion(ctx context.Context, id pgtype.UUID) (int64, error)
+	// Leases the oldest unpublished events that no other relay holds and counts
+	// the delivery attempt up front.
+	ClaimOutboxEvents(ctx context.Context, arg ClaimOutboxEventsParams) ([]OutboxEvent, error)
+	// Throttles verification emails: only matches when the cooldown since the
+	// last email has passed, and records the new send time.
+	ClaimVerificationEmailSlot(ctx context.Context, arg ClaimVerificationEmailSlotParams) (int64, error)
+	ConfirmTotp(ctx context.Context, arg ConfirmTotpParams) (int64, error)
+	ConsumeMfaChallenge(ctx context.Context, id pgtype.UUID) (int64, error)
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (pgtype.UUID, error)
+	// Members whose accounts are neither deleted nor scheduled for deletion.
+	CountActiveRoleMembers(ctx context.Context, roleID pgtype.UUID) (int64, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID pgtype.UUID) (int64, error)
+	CreateAuditEvent(ctx context.Context, arg CreateAuditEventParams) error
 	CreateDevice(ctx context.Context, arg CreateDeviceParams) (Device, error)
+	CreateMfaChallenge(ctx context.Context, arg CreateMfaChallengeParams) (MfaChallenge, error)
+	CreateOutboxEvent(ctx context.Context, arg CreateOutboxEventParams) error
+	// Inserts nothing while a token was issued to the user within the cooldown,
+	// which keeps /password/forgot from flooding an inbox.
+	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) (int64, error)
 	CreateRole(ctx context.Context, arg CreateRoleParams) (Role, error)
+	// Returns no row when a role with the name already exists.
+	CreateRoleIfMissing(ctx context.Context, arg CreateRoleIfMissingParams) (Role, error)
 	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	// Assigning a role the user already has returns the existing assignment.
 	CreateUserRole(ctx context.Context, arg CreateUserRoleParams) (UserRole, error)
+	CreateWebauthnCeremony(ctx context.Context, arg CreateWebauthnCeremonyParams) (pgtype.UUID, error)
+	CreateWebauthnCredential(ctx context.Context, arg CreateWebauthnCredentialParams) (WebauthnCredential, error)
+	DeleteExpiredWebauthnCeremonies(ctx context.Context) (int64, error)
+	DeleteRecoveryCodes(ctx context.Context, userID pgtype.UUID) error
+	DeleteRole(ctx context.Context, id pgtype.UUID) (int64, error)
+	DeleteRolePermissions(ctx context.Context, roleID pgtype.UUID) error
+	DeleteStaleLoginThrottles(ctx context.Context, before pgtype.Timestamp) (int64, error)
+	DeleteTotp(ctx context.Context, userID pgtype.UUID) error
+	DeleteUser(ctx context.Context, id pgtype.UUID) error
+	DeleteUserRole(ctx context.Context, arg DeleteUserRoleParams) (int64, error)
+	DeleteWebauthnCredential(ctx context.Context, arg DeleteWebauthnCredentialParams) (int64, error)
 	FindDeviceByUserAndIP(ctx context.Context, arg FindDeviceByUserAndIPParams) (pgtype.UUID, error)
 	FindRoleByName(ctx context.Context, name string) (Role, error)
 	FindUserByEmail(ctx context.Context, email string) (User, error)
 	FindUserByOauthProvider(ctx context.Context, arg FindUserByOauthProviderParams) (User, error)
+	GetActiveSession(ctx context.Context, arg GetActiveSessionParams) (Session, error)
+	// Seconds until the longest block among the keys ends; 0 when none applies.
+	GetLoginRetryAfter(ctx context.Context, keys []string) (int32, error)
+	GetMfaChallengeByTokenHash(ctx context.Context, tokenHash string) (MfaChallenge, error)
+	GetRoleByID(ctx context.Context, id pgtype.UUID) (Role, error)
+	GetRolePermissionNames(ctx context.Context, roleID pgtype.UUID) ([]string, error)
+	GetSessionByRefreshTokenHash(ctx context.Context, refreshTokenHash pgtype.Text) (Session, error)
+	GetTotpByUser(ctx context.Context, userID pgtype.UUID) (MfaTotp, error)
+	GetUserByID(ctx context.Context, id pgtype.UUID) (User, error)
+	GetUserByPasswordResetToken(ctx context.Context, tokenHash string) (User, error)
+	// Every permission granted to any of the user's roles.
+	GetUserPermissions(ctx context.Context, userID pgtype.UUID) ([]string, error)
+	GetUserRoleNames(ctx context.Context, userID pgtype.UUID) ([]string, error)
 	GetUserWithLatestDevice(ctx context.Context, id pgtype.UUID) (GetUserWithLatestDeviceRow, error)
+	GetWebauthnCredentialByCredentialID(ctx context.Context, credentialID []byte) (WebauthnCredential, error)
+	// Grants the named permissions that exist; unknown names are skipped, so
+	// callers compare the count with what they asked for.
+	GrantRolePermissions(ctx context.Context, arg GrantRolePermissionsParams) (int64, error)
+	IncrementMfaChallengeAttempts(ctx context.Context, id pgtype.UUID) (int32, error)
+	InvalidatePasswordResetTokens(ctx context.Context, userID pgtype.UUID) error
+	ListActiveSessionsByUser(ctx context.Context, userID pgtype.UUID) ([]ListActiveSessionsByUserRow, error)
+	ListAuditEventsByUser(ctx context.Context, userID pgtype.UUID) ([]ListAuditEventsByUserRow, error)
+	ListDevicesByUser(ctx context.Context, userID pgtype.UUID) ([]Device, error)
+	ListPermissions(ctx context.Context) ([]Permission, error)
+	ListRoles(ctx context.Context) ([]ListRolesRow, error)
+	ListSessionsByUser(ctx context.Context, userID pgtype.UUID) ([]ListSessionsByUserRow, error)
+	ListUnhashedSessions(ctx context.Context) ([]ListUnhashedSessionsRow, error)
+	// Newest first, for the admin console. Filters left NULL match everything;
+	// with a cursor the page starts after that (created_at, id), which is why
+	// created_at is NOT NULL.
+	ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUsersRow, error)
+	ListUsersDueForDeletion(ctx context.Context, limit int32) ([]ListUsersDueForDeletionRow, error)
+	ListWebauthnCredentialsByUser(ctx context.Context, userID pgtype.UUID) ([]WebauthnCredential, error)
+	// Serializes changes to a role's membership until the transaction ends.
+	LockRole(ctx context.Context, id pgtype.UUID) error
+	MarkEmailVerified(ctx context.Context, id pgtype.UUID) error
+	MarkOutboxEventPublished(ctx context.Context, id pgtype.UUID) error
+	// Counts a failure, starting over when the previous one is older than the
+	// window and no block is in force.
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error)
+	// The attempt was already counted by ClaimOutboxEvents.
+	RecordOutboxEventFailure(ctx context.Context, id pgtype.UUID) error
+	RecordTotpStep(ctx context.Context, arg RecordTotpStepParams) (int64, error)
+	// Hands back leased events that were never tried, undoing their attempt.
+	ReleaseOutboxEvents(ctx context.Context, ids []pgtype.UUID) error
+	// Swaps in a rehashed password unless the password changed since it was read.
+	ReplacePasswordHash(ctx context.Context, arg ReplacePasswordHashParams) (int64, error)
+	ReplaceRecoveryCodes(ctx context.Context, arg ReplaceRecoveryCodesParams) error
+	ResetLoginThrottle(ctx context.Context, key string) error
+	RevokeOtherUserSessions(ctx context.Context, arg RevokeOtherUserSessionsParams) (int64, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error)
+	RevokeUserSessions(ctx context.Context, userID pgtype.UUID) (int64, error)
+	RotateSessionToken(ctx context.Context, arg RotateSessionTokenParams) (Session, error)
+	ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (int64, error)
+	ScrubUserAuditEvents(ctx context.Context, userID pgtype.UUID) error
+	SetSessionRefreshTokenHash(ctx context.Context, arg SetSessionRefreshTokenHashParams) error
+	SetUserMfaEnabled(ctx context.Context, arg SetUserMfaEnabledParams) error
+	TakeWebauthnCeremony(ctx context.Context, arg TakeWebauthnCeremonyParams) (WebauthnCeremony, error)
+	// Lifts a lock that started before the unlock link was issued, so a link
+	// cannot be replayed against a later lock.
+	UnlockLogin(ctx context.Context, arg UnlockLoginParams) (int64, error)
 	UpdateDeviceLastSeen(ctx context.Context, arg UpdateDeviceLastSeenParams) error
+	UpdateRole(ctx context.Context, arg UpdateRoleParams) (Role, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateWebauthnCredentialUsage(ctx context.Context, arg UpdateWebauthnCredentialUsageParams) error
+	UpsertPendingTotp(ctx context.Context, arg UpsertPendingTotpParams) (int64, error)
+	UpsertPermission(ctx context.Context, arg UpsertPermissionParams) error
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -11,6 +11,30 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const claimVerificationEmailSlot = `-- name: ClaimVerificationEmailSlot :execrows
+UPDATE users
+SET verification_sent_at = now()
+WHERE id = $1
+  AND email_verified = FALSE
+  AND (verification_sent_at IS NULL
+       OR verification_sent_at < now() - make_interval(secs => $2::int))
+`
+
+type ClaimVerificationEmailSlotParams struct {
+	ID              pgtype.UUID `json:"id"`
+	CooldownSeconds int32       `json:"cooldown_seconds"`
+}
+
+// Throttles verification emails: only matches when the cooldown since the
+// last email has passed, and records the new send time.
+func (q *Queries) ClaimVerificationEmailSlot(ctx context.Context, arg ClaimVerificationEmailSlotParams) (int64, error) {
+	result, err := q.db.Exec(ctx, claimVerificationEmailSlot, arg.ID, arg.CooldownSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createDevice = `-- name: CreateDevice :one
 INSERT INTO devices (
     user_id,
@@ -82,23 +106,30 @@ func (q *Queries) CreateRole(ctx context.Context, arg CreateRoleParams) (Role, e
 
 const createSession = `-- name: CreateSession :one
 INSERT INTO sessions (
+    id,
     user_id,
-    refresh_token,
+    refresh_token_hash,
     expires_at
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4
 )
-RETURNING id, user_id, refresh_token, expires_at, created_at, updated_at
+RETURNING id, user_id, refresh_token, expires_at, created_at, updated_at, revoked_at, refresh_token_hash, device_id
 `
 
 type CreateSessionParams struct {
-	UserID       pgtype.UUID      `json:"user_id"`
-	RefreshToken string           `json:"refresh_token"`
-	ExpiresAt    pgtype.Timestamp `json:"expires_at"`
+	ID               pgtype.UUID      `json:"id"`
+	UserID           pgtype.UUID      `json:"user_id"`
+	RefreshTokenHash pgtype.Text      `json:"refresh_token_hash"`
+	ExpiresAt        pgtype.Timestamp `json:"expires_at"`
 }
 
 func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
-	row := q.db.QueryRow(ctx, createSession, arg.UserID, arg.RefreshToken, arg.ExpiresAt)
+	row := q.db.QueryRow(ctx, createSession,
+		arg.ID,
+		arg.UserID,
+		arg.RefreshTokenHash,
+		arg.ExpiresAt,
+	)
 	var i Session
 	err := row.Scan(
 		&i.ID,
@@ -107,14 +138,17 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 		&i.ExpiresAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.RevokedAt,
+		&i.RefreshTokenHash,
+		&i.DeviceID,
 	)
 	return i, err
 }
 
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, risk_score, created_at, updated_at
+INSERT INTO users (email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, email_verified)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, risk_score, created_at, updated_at, email_verified, email_verified_at, verification_sent_at, deletion_requested_at, deletion_scheduled_for, deleted_at
 `
 
 type CreateUserParams struct {
@@ -123,6 +157,7 @@ type CreateUserParams struct {
 	OauthProvider   pgtype.Text `json:"oauth_provider"`
 	OauthProviderID pgtype.Text `json:"oauth_provider_id"`
 	MfaEnabled      pgtype.Bool `json:"mfa_enabled"`
+	EmailVerified   bool        `json:"email_verified"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
@@ -132,6 +167,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		arg.OauthProvider,
 		arg.OauthProviderID,
 		arg.MfaEnabled,
+		arg.EmailVerified,
 	)
 	var i User
 	err := row.Scan(
@@ -144,6 +180,12 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.RiskScore,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EmailVerified,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledFor,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -155,6 +197,7 @@ INSERT INTO user_roles (
 ) VALUES (
     $1, $2
 )
+ON CONFLICT (user_id, role_id) DO UPDATE SET assigned_at = user_roles.assigned_at
 RETURNING id, user_id, role_id, assigned_at
 `
 
@@ -163,6 +206,7 @@ type CreateUserRoleParams struct {
 	RoleID pgtype.UUID `json:"role_id"`
 }
 
+// Assigning a role the user already has returns the existing assignment.
 func (q *Queries) CreateUserRole(ctx context.Context, arg CreateUserRoleParams) (UserRole, error) {
 	row := q.db.QueryRow(ctx, createUserRole, arg.UserID, arg.RoleID)
 	var i UserRole
@@ -212,7 +256,7 @@ func (q *Queries) FindRoleByName(ctx context.Context, name string) (Role, error)
 }
 
 const findUserByEmail = `-- name: FindUserByEmail :one
-SELECT id, email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, risk_score, created_at, updated_at FROM users WHERE email = $1
+SELECT id, email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, risk_score, created_at, updated_at, email_verified, email_verified_at, verification_sent_at, deletion_requested_at, deletion_scheduled_for, deleted_at FROM users WHERE email = $1
 `
 
 func (q *Queries) FindUserByEmail(ctx context.Context, email string) (User, error) {
@@ -228,12 +272,18 @@ func (q *Queries) FindUserByEmail(ctx context.Context, email string) (User, erro
 		&i.RiskScore,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EmailVerified,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledFor,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
 const findUserByOauthProvider = `-- name: FindUserByOauthProvider :one
-SELECT id, email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, risk_score, created_at, updated_at FROM users 
+SELECT id, email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, risk_score, created_at, updated_at, email_verified, email_verified_at, verification_sent_at, deletion_requested_at, deletion_scheduled_for, deleted_at FROM users 
 WHERE oauth_provider = $1 AND oauth_provider_id = $2
 `
 
@@ -255,6 +305,40 @@ func (q *Queries) FindUserByOauthProvider(ctx context.Context, arg FindUserByOau
 		&i.RiskScore,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.EmailVerified,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledFor,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, risk_score, created_at, updated_at, email_verified, email_verified_at, verification_sent_at, deletion_requested_at, deletion_scheduled_for, deleted_at FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id pgtype.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.OauthProvider,
+		&i.OauthProviderID,
+		&i.MfaEnabled,
+		&i.RiskScore,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EmailVerified,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.DeletionRequestedAt,
+		&i.DeletionScheduledFor,
+		&i.DeletedAt,
 	)
 	return i, err
 }
@@ -263,6 +347,7 @@ const getUserWithLatestDevice = `-- name: GetUserWithLatestDevice :one
 SELECT 
     u.id as user_id, 
     u.email, 
+    u.email_verified,
     u.created_at as user_created_at,
     d.device_name, 
     d.last_seen
@@ -276,6 +361,7 @@ LIMIT 1
 type GetUserWithLatestDeviceRow struct {
 	UserID        pgtype.UUID      `json:"user_id"`
 	Email         string           `json:"email"`
+	EmailVerified bool             `json:"email_verified"`
 	UserCreatedAt pgtype.Timestamp `json:"user_created_at"`
 	DeviceName    pgtype.Text      `json:"device_name"`
 	LastSeen      pgtype.Timestamp `json:"last_seen"`
@@ -287,6 +373,7 @@ func (q *Queries) GetUserWithLatestDevice(ctx context.Context, id pgtype.UUID) (
 	err := row.Scan(
 		&i.UserID,
 		&i.Email,
+		&i.EmailVerified,
 		&i.UserCreatedAt,
 		&i.DeviceName,
 		&i.LastSeen,
@@ -294,6 +381,158 @@ func (q *Queries) GetUserWithLatestDevice(ctx context.Context, id pgtype.UUID) (
 	return i, err
 }
 
+const listDevicesByUser = `-- name: ListDevicesByUser :many
+SELECT id, user_id, device_name, device_type, ip_address, last_seen, created_at FROM devices
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) ListDevicesByUser(ctx context.Context, userID pgtype.UUID) ([]Device, error) {
+	rows, err := q.db.Query(ctx, listDevicesByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Device
+	for rows.Next() {
+		var i Device
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.DeviceName,
+			&i.DeviceType,
+			&i.IpAddress,
+			&i.LastSeen,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT
+    u.id,
+    u.email,
+    u.oauth_provider,
+    u.mfa_enabled,
+    u.risk_score,
+    u.email_verified,
+    u.created_at,
+    u.deletion_scheduled_for,
+    COALESCE((
+        SELECT array_agg(r.name ORDER BY r.name)
+        FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = u.id
+    ), '{}')::text[] AS roles
+FROM users u
+WHERE u.deleted_at IS NULL
+  AND ($1::text IS NULL OR starts_with(lower(u.email), lower($1)))
+  AND ($2::text IS NULL OR COALESCE(u.oauth_provider, 'password') = $2)
+  AND ($3::text IS NULL OR EXISTS (
+        SELECT 1
+        FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = u.id AND r.name = $3
+      ))
+  AND ($4::timestamp IS NULL OR u.created_at >= $4)
+  AND ($5::timestamp IS NULL OR u.created_at < $5)
+  AND ($6::int IS NULL OR COALESCE(u.risk_score, 0) >= $6)
+  AND ($7::int IS NULL OR COALESCE(u.risk_score, 0) <= $7)
+  AND ($8::timestamp IS NULL
+       OR (u.created_at, u.id) < ($8, $9::uuid))
+ORDER BY u.created_at DESC, u.id DESC
+LIMIT $10
+`
+
+type ListUsersParams struct {
+	EmailPrefix     pgtype.Text      `json:"email_prefix"`
+	Provider        pgtype.Text      `json:"provider"`
+	Role            pgtype.Text      `json:"role"`
+	CreatedAfter    pgtype.Timestamp `json:"created_after"`
+	CreatedBefore   pgtype.Timestamp `json:"created_before"`
+	MinRisk         pgtype.Int4      `json:"min_risk"`
+	MaxRisk         pgtype.Int4      `json:"max_risk"`
+	CursorCreatedAt pgtype.Timestamp `json:"cursor_created_at"`
+	CursorID        pgtype.UUID      `json:"cursor_id"`
+	PageSize        int32            `json:"page_size"`
+}
+
+type ListUsersRow struct {
+	ID                   pgtype.UUID      `json:"id"`
+	Email                string           `json:"email"`
+	OauthProvider        pgtype.Text      `json:"oauth_provider"`
+	MfaEnabled           pgtype.Bool      `json:"mfa_enabled"`
+	RiskScore            pgtype.Int4      `json:"risk_score"`
+	EmailVerified        bool             `json:"email_verified"`
+	CreatedAt            pgtype.Timestamp `json:"created_at"`
+	DeletionScheduledFor pgtype.Timestamp `json:"deletion_scheduled_for"`
+	Roles                []string         `json:"roles"`
+}
+
+// Newest first, for the admin console. Filters left NULL match everything;
+// with a cursor the page starts after that (created_at, id), which is why
+// created_at is NOT NULL.
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUsersRow, error) {
+	rows, err := q.db.Query(ctx, listUsers,
+		arg.EmailPrefix,
+		arg.Provider,
+		arg.Role,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.MinRisk,
+		arg.MaxRisk,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersRow
+	for rows.Next() {
+		var i ListUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.OauthProvider,
+			&i.MfaEnabled,
+			&i.RiskScore,
+			&i.EmailVerified,
+			&i.CreatedAt,
+			&i.DeletionScheduledFor,
+			&i.Roles,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified = TRUE,
+    email_verified_at = COALESCE(email_verified_at, now()),
+    updated_at = now()
+WHERE id = $1
+`
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, id pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, markEmailVerified, id)
+	return err
+}
+
 const updateDeviceLastSeen = `-- name: UpdateDeviceLastSeen :exec
 UPDATE devices 
 SET last_seen = $2 
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE sessions ADD COLUMN revoked_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN revoked_at;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Refresh tokens are stored as a keyed hash only. The key lives in the
+-- application, so existing rows are hashed at startup by the auth service,
+-- which then clears the plaintext column.
+ALTER TABLE sessions ADD COLUMN refresh_token_hash TEXT;
+ALTER TABLE sessions ALTER COLUMN refresh_token DROP NOT NULL;
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_refresh_token_key;
+DROP INDEX IF EXISTS idx_sessions_refresh_token;
+CREATE UNIQUE INDEX idx_sessions_refresh_token ON sessions(refresh_token_hash);
+
+-- +goose Down
+-- Plaintext tokens cannot be recovered from their hashes, so those sessions are dropped
+DROP INDEX IF EXISTS idx_sessions_refresh_token;
+DELETE FROM sessions WHERE refresh_token IS NULL;
+ALTER TABLE sessions ALTER COLUMN refresh_token SET NOT NULL;
+ALTER TABLE sessions DROP COLUMN refresh_token_hash;
+CREATE UNIQUE INDEX idx_sessions_refresh_token ON sessions(refresh_token);
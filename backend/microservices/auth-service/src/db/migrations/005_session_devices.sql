@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE sessions ADD COLUMN device_id UUID REFERENCES devices(id) ON DELETE SET NULL;
+CREATE INDEX idx_sessions_device_id ON sessions(device_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_sessions_device_id;
+ALTER TABLE sessions DROP COLUMN device_id;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- One TOTP authenticator per user. The secret is AES-GCM encrypted by the
+-- service; confirmed_at stays NULL until the user proves the enrollment with
+-- a first code, and last_used_step stops a code from being replayed.
+CREATE TABLE mfa_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret_encrypted BYTEA NOT NULL,
+    confirmed_at TIMESTAMP,
+    last_used_step BIGINT,
+    created_at TIMESTAMP DEFAULT now()
+);
+
+-- Short-lived second-factor challenges handed out by Login when MFA is on.
+-- Only a hash of the challenge token is stored, like refresh tokens.
+CREATE TABLE mfa_challenges (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT UNIQUE NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now()
+);
+CREATE INDEX idx_mfa_challenges_user_id ON mfa_challenges(user_id);
+
+-- +goose Down
+DROP TABLE mfa_challenges;
+DROP TABLE mfa_totp;
@@ -0,0 +1,38 @@
+-- +goose Up
+-- Passkeys and security keys registered through WebAuthn. credential_id is
+-- the authenticator-chosen ID the browser sends back on every login.
+CREATE TABLE webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA UNIQUE NOT NULL,
+    public_key BYTEA NOT NULL,
+    attestation_type TEXT NOT NULL,
+    aaguid BYTEA,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    clone_warning BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    attachment TEXT,
+    name TEXT,
+    created_at TIMESTAMP DEFAULT now(),
+    last_used_at TIMESTAMP
+);
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- Challenges of registration and login ceremonies in flight. Each row is
+-- deleted when the ceremony finishes, so a challenge can only be answered once.
+-- user_id is NULL for usernameless (discoverable) logins.
+CREATE TABLE webauthn_ceremonies (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    session_data JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT now()
+);
+CREATE INDEX idx_webauthn_ceremonies_expires_at ON webauthn_ceremonies(expires_at);
+
+-- +goose Down
+DROP TABLE webauthn_ceremonies;
+DROP TABLE webauthn_credentials;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- Single-use MFA recovery codes. Only a keyed hash of each code is stored.
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT now()
+);
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+-- Security-relevant events on an account, kept for support and incident review
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event_type TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    metadata JSONB,
+    created_at TIMESTAMP DEFAULT now()
+);
+CREATE INDEX idx_audit_events_user_id ON audit_events(user_id, created_at);
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP TABLE mfa_recovery_codes;
@@ -0,0 +1,14 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN email_verified_at TIMESTAMP,
+    ADD COLUMN verification_sent_at TIMESTAMP;
+
+-- Accounts that predate verification keep the access they already had
+UPDATE users SET email_verified = TRUE, email_verified_at = now();
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN verification_sent_at,
+    DROP COLUMN email_verified_at,
+    DROP COLUMN email_verified;
@@ -0,0 +1,30 @@
+-- +goose Up
+-- Self-service deletion: an account is scheduled first and purged once the
+-- grace period has passed. Anonymised accounts keep their row with deleted_at set.
+ALTER TABLE users
+    ADD COLUMN deletion_requested_at TIMESTAMP,
+    ADD COLUMN deletion_scheduled_for TIMESTAMP,
+    ADD COLUMN deleted_at TIMESTAMP;
+CREATE INDEX idx_users_deletion_scheduled_for ON users(deletion_scheduled_for)
+    WHERE deletion_scheduled_for IS NOT NULL;
+
+-- Transactional outbox: events are written in the same transaction as the
+-- change they describe and published to other services afterwards.
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    published_at TIMESTAMP
+);
+CREATE INDEX idx_outbox_events_unpublished ON outbox_events(created_at)
+    WHERE published_at IS NULL;
+
+-- +goose Down
+DROP TABLE outbox_events;
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_for;
+ALTER TABLE users
+    DROP COLUMN deleted_at,
+    DROP COLUMN deletion_scheduled_for,
+    DROP COLUMN deletion_requested_at;
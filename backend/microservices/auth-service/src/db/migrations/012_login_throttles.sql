@@ -0,0 +1,15 @@
+-- +goose Up
+-- Failed login counters shared by every replica. key is "account:<email>"
+-- or "ip:<address>"; rows for unknown addresses are kept too, so a lockout
+-- looks the same whether or not the account exists.
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT now(),
+    blocked_until TIMESTAMP,
+    locked_at TIMESTAMP
+);
+CREATE INDEX idx_login_throttles_last_failure_at ON login_throttles(last_failure_at);
+
+-- +goose Down
+DROP TABLE login_throttles;
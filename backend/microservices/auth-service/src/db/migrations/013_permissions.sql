@@ -0,0 +1,21 @@
+-- +goose Up
+-- Permissions are named "<resource>:<action>", e.g. users:read. A user holds
+-- every permission granted to any of their roles.
+CREATE TABLE permissions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name TEXT UNIQUE NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE role_permissions (
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    permission_id UUID NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    granted_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (role_id, permission_id)
+);
+CREATE INDEX idx_role_permissions_permission_id ON role_permissions(permission_id);
+
+-- +goose Down
+DROP TABLE role_permissions;
+DROP TABLE permissions;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Keep the earliest of any duplicate assignments so the constraint can be
+-- added; assigning a role twice is a no-op from now on.
+DELETE FROM user_roles a
+USING user_roles b
+WHERE a.user_id = b.user_id
+  AND a.role_id = b.role_id
+  AND (COALESCE(a.assigned_at, '-infinity'), a.id) > (COALESCE(b.assigned_at, '-infinity'), b.id);
+
+ALTER TABLE user_roles ADD CONSTRAINT user_roles_user_id_role_id_key UNIQUE (user_id, role_id);
+
+-- +goose Down
+ALTER TABLE user_roles DROP CONSTRAINT user_roles_user_id_role_id_key;
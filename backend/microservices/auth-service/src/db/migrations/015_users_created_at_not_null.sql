@@ -0,0 +1,14 @@
+-- +goose Up
+-- The admin user list pages by (created_at, id), which skips rows whose
+-- created_at is NULL. Nothing writes NULL on purpose; backfill any that
+-- exist from updated_at and forbid them from now on.
+UPDATE users
+SET created_at = COALESCE(updated_at, now())
+WHERE created_at IS NULL;
+
+ALTER TABLE users ALTER COLUMN created_at SET NOT NULL;
+CREATE INDEX idx_users_created_at_id ON users(created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_created_at_id;
+ALTER TABLE users ALTER COLUMN created_at DROP NOT NULL;
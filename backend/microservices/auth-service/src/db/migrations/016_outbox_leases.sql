@@ -0,0 +1,8 @@
+-- +goose Up
+-- The relay leases a batch of events in a short statement and delivers them
+-- outside any transaction. Events whose lease ran out, because the relay
+-- died mid-batch, can be claimed again.
+ALTER TABLE outbox_events ADD COLUMN claimed_until TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE outbox_events DROP COLUMN claimed_until;
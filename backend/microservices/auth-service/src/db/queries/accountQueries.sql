@@ -0,0 +1,64 @@
+-- name: ScheduleUserDeletion :execrows
+UPDATE users
+SET deletion_requested_at = now(),
+    deletion_scheduled_for = $2,
+    updated_at = now()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_requested_at = NULL,
+    deletion_scheduled_for = NULL,
+    updated_at = now()
+WHERE id = $1
+  AND deletion_scheduled_for IS NOT NULL
+  AND deleted_at IS NULL;
+
+-- name: ListUsersDueForDeletion :many
+SELECT id, email FROM users
+WHERE deletion_scheduled_for <= now()
+  AND deleted_at IS NULL
+ORDER BY deletion_scheduled_for
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: DeleteUser :exec
+DELETE FROM users
+WHERE id = $1;
+
+-- name: AnonymizeUser :exec
+-- Removes everything that identifies the person but keeps the row, so IDs
+-- other services still hold keep pointing at a (deleted) user.
+WITH deleted_sessions AS (
+    DELETE FROM sessions WHERE user_id = $1
+), deleted_devices AS (
+    DELETE FROM devices WHERE user_id = $1
+), deleted_roles AS (
+    DELETE FROM user_roles WHERE user_id = $1
+), deleted_totp AS (
+    DELETE FROM mfa_totp WHERE user_id = $1
+), deleted_recovery_codes AS (
+    DELETE FROM mfa_recovery_codes WHERE user_id = $1
+), deleted_challenges AS (
+    DELETE FROM mfa_challenges WHERE user_id = $1
+), deleted_passkeys AS (
+    DELETE FROM webauthn_credentials WHERE user_id = $1
+), deleted_ceremonies AS (
+    DELETE FROM webauthn_ceremonies WHERE user_id = $1
+), deleted_reset_tokens AS (
+    DELETE FROM password_reset_tokens WHERE user_id = $1
+)
+UPDATE users
+SET email = 'deleted-' || users.id::text || '@deleted.invalid',
+    password_hash = NULL,
+    oauth_provider = NULL,
+    oauth_provider_id = NULL,
+    mfa_enabled = FALSE,
+    risk_score = 0,
+    email_verified = FALSE,
+    email_verified_at = NULL,
+    verification_sent_at = NULL,
+    deletion_scheduled_for = NULL,
+    deleted_at = now(),
+    updated_at = now()
+WHERE users.id = $1;
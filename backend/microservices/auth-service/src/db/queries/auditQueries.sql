@@ -0,0 +1,22 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+    user_id,
+    event_type,
+    ip_address,
+    user_agent,
+    metadata
+) VALUES (
+    $1, $2, $3, $4, $5
+);
+
+-- name: ListAuditEventsByUser :many
+SELECT event_type, ip_address, user_agent, metadata, created_at
+FROM audit_events
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ScrubUserAuditEvents :exec
+UPDATE audit_events
+SET ip_address = NULL,
+    user_agent = NULL
+WHERE user_id = $1;
@@ -0,0 +1,44 @@
+-- name: GetLoginRetryAfter :one
+-- Seconds until the longest block among the keys ends; 0 when none applies.
+SELECT COALESCE(CEIL(EXTRACT(EPOCH FROM MAX(blocked_until) - now())), 0)::int AS retry_after_seconds
+FROM login_throttles
+WHERE key = ANY(sqlc.arg(keys)::text[])
+  AND blocked_until > now();
+
+-- name: RecordLoginFailure :one
+-- Counts a failure, starting over when the previous one is older than the
+-- window and no block is in force.
+INSERT INTO login_throttles (key, failures, last_failure_at)
+VALUES (sqlc.arg(key), 1, now())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failure_at < now() - make_interval(secs => sqlc.arg(window_seconds)::int)
+         AND (login_throttles.blocked_until IS NULL OR login_throttles.blocked_until <= now())
+        THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failure_at = now()
+RETURNING failures;
+
+-- name: BlockLogin :exec
+UPDATE login_throttles
+SET blocked_until = now() + make_interval(secs => sqlc.arg(seconds)::int),
+    locked_at = CASE WHEN sqlc.arg(lock)::bool THEN now() ELSE locked_at END
+WHERE key = sqlc.arg(key);
+
+-- name: ResetLoginThrottle :exec
+DELETE FROM login_throttles
+WHERE key = $1;
+
+-- name: UnlockLogin :execrows
+-- Lifts a lock that started before the unlock link was issued, so a link
+-- cannot be replayed against a later lock.
+DELETE FROM login_throttles
+WHERE key = sqlc.arg(key)
+  AND locked_at IS NOT NULL
+  AND locked_at <= sqlc.arg(locked_before);
+
+-- name: DeleteStaleLoginThrottles :execrows
+DELETE FROM login_throttles
+WHERE last_failure_at < sqlc.arg(before)
+  AND (blocked_until IS NULL OR blocked_until < now());
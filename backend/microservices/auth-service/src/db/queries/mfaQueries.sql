@@ -0,0 +1,82 @@
+-- name: UpsertPendingTotp :execrows
+INSERT INTO mfa_totp (user_id, secret_encrypted)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret_encrypted = EXCLUDED.secret_encrypted,
+    last_used_step = NULL,
+    created_at = now()
+WHERE mfa_totp.confirmed_at IS NULL;
+
+-- name: GetTotpByUser :one
+SELECT * FROM mfa_totp
+WHERE user_id = $1;
+
+-- name: ConfirmTotp :execrows
+UPDATE mfa_totp
+SET confirmed_at = now(),
+    last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: RecordTotpStep :execrows
+UPDATE mfa_totp
+SET last_used_step = sqlc.arg(step)
+WHERE user_id = sqlc.arg(user_id)
+  AND (last_used_step IS NULL OR last_used_step < sqlc.arg(step));
+
+-- name: DeleteTotp :exec
+DELETE FROM mfa_totp
+WHERE user_id = $1;
+
+-- name: SetUserMfaEnabled :exec
+UPDATE users
+SET mfa_enabled = $2,
+    updated_at = now()
+WHERE id = $1;
+
+-- name: CreateMfaChallenge :one
+INSERT INTO mfa_challenges (
+    user_id,
+    token_hash,
+    expires_at
+) VALUES (
+    $1, $2, $3
+)
+RETURNING *;
+
+-- name: GetMfaChallengeByTokenHash :one
+SELECT * FROM mfa_challenges
+WHERE token_hash = $1
+  AND consumed_at IS NULL
+  AND expires_at > now();
+
+-- name: IncrementMfaChallengeAttempts :one
+UPDATE mfa_challenges
+SET attempts = attempts + 1
+WHERE id = $1
+RETURNING attempts;
+
+-- name: ConsumeMfaChallenge :execrows
+UPDATE mfa_challenges
+SET consumed_at = now()
+WHERE id = $1 AND consumed_at IS NULL;
+
+-- name: ReplaceRecoveryCodes :exec
+WITH removed AS (
+    DELETE FROM mfa_recovery_codes
+    WHERE user_id = sqlc.arg(user_id)
+)
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+SELECT sqlc.arg(user_id), unnest(sqlc.arg(code_hashes)::text[]);
+
+-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = now()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: CountUnusedRecoveryCodes :one
+SELECT count(*) FROM mfa_recovery_codes
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes
+WHERE user_id = $1;
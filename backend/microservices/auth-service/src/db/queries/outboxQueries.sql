@@ -0,0 +1,43 @@
+-- name: CreateOutboxEvent :exec
+INSERT INTO outbox_events (
+    event_type,
+    payload
+) VALUES (
+    $1, $2
+);
+
+-- name: ClaimOutboxEvents :many
+-- Leases the oldest unpublished events that no other relay holds and counts
+-- the delivery attempt up front.
+UPDATE outbox_events
+SET claimed_until = now() + make_interval(secs => sqlc.arg(lease_seconds)::int),
+    attempts = attempts + 1
+WHERE id IN (
+    SELECT id FROM outbox_events
+    WHERE published_at IS NULL
+      AND (claimed_until IS NULL OR claimed_until < now())
+    ORDER BY created_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkOutboxEventPublished :exec
+UPDATE outbox_events
+SET published_at = now(),
+    claimed_until = NULL
+WHERE id = $1;
+
+-- name: RecordOutboxEventFailure :exec
+-- The attempt was already counted by ClaimOutboxEvents.
+UPDATE outbox_events
+SET claimed_until = NULL
+WHERE id = $1;
+
+-- name: ReleaseOutboxEvents :exec
+-- Hands back leased events that were never tried, undoing their attempt.
+UPDATE outbox_events
+SET claimed_until = NULL,
+    attempts = attempts - 1
+WHERE id = ANY(sqlc.arg(ids)::uuid[])
+  AND published_at IS NULL;
@@ -0,0 +1,47 @@
+-- name: CreatePasswordResetToken :execrows
+-- Inserts nothing while a token was issued to the user within the cooldown,
+-- which keeps /password/forgot from flooding an inbox.
+INSERT INTO password_reset_tokens (
+    user_id,
+    token_hash,
+    expires_at
+)
+SELECT sqlc.arg(user_id), sqlc.arg(token_hash), sqlc.arg(expires_at)
+WHERE NOT EXISTS (
+    SELECT 1 FROM password_reset_tokens
+    WHERE user_id = sqlc.arg(user_id)
+      AND created_at > now() - make_interval(secs => sqlc.arg(cooldown_seconds)::int)
+);
+
+-- name: ConsumePasswordResetToken :one
+UPDATE password_reset_tokens
+SET used_at = now()
+WHERE token_hash = $1
+  AND used_at IS NULL
+  AND expires_at > now()
+RETURNING user_id;
+
+-- name: GetUserByPasswordResetToken :one
+SELECT users.* FROM users
+JOIN password_reset_tokens t ON t.user_id = users.id
+WHERE t.token_hash = $1
+  AND t.used_at IS NULL
+  AND t.expires_at > now();
+
+-- name: InvalidatePasswordResetTokens :exec
+UPDATE password_reset_tokens
+SET used_at = now()
+WHERE user_id = $1 AND used_at IS NULL;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET password_hash = $2,
+    updated_at = now()
+WHERE id = $1;
+
+-- name: ReplacePasswordHash :execrows
+-- Swaps in a rehashed password unless the password changed since it was read.
+UPDATE users
+SET password_hash = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id)
+  AND password_hash = sqlc.arg(old_hash);
@@ -0,0 +1,88 @@
+-- name: CountActiveRoleMembers :one
+-- Members whose accounts are neither deleted nor scheduled for deletion.
+SELECT COUNT(*)
+FROM user_roles ur
+JOIN users u ON u.id = ur.user_id
+WHERE ur.role_id = $1
+  AND u.deleted_at IS NULL
+  AND u.deletion_scheduled_for IS NULL;
+
+-- name: CreateRoleIfMissing :one
+-- Returns no row when a role with the name already exists.
+INSERT INTO roles (name, description)
+VALUES ($1, $2)
+ON CONFLICT (name) DO NOTHING
+RETURNING *;
+
+-- name: DeleteRole :execrows
+DELETE FROM roles WHERE id = $1;
+
+-- name: DeleteRolePermissions :exec
+DELETE FROM role_permissions WHERE role_id = $1;
+
+-- name: DeleteUserRole :execrows
+DELETE FROM user_roles
+WHERE user_id = $1 AND role_id = $2;
+
+-- name: GetRoleByID :one
+SELECT * FROM roles WHERE id = $1;
+
+-- name: GetRolePermissionNames :many
+SELECT p.name
+FROM permissions p
+JOIN role_permissions rp ON rp.permission_id = p.id
+WHERE rp.role_id = $1
+ORDER BY p.name;
+
+-- name: GetUserPermissions :many
+-- Every permission granted to any of the user's roles.
+SELECT DISTINCT p.name
+FROM permissions p
+JOIN role_permissions rp ON rp.permission_id = p.id
+JOIN user_roles ur ON ur.role_id = rp.role_id
+WHERE ur.user_id = $1
+ORDER BY p.name;
+
+-- name: GetUserRoleNames :many
+SELECT r.name
+FROM roles r
+JOIN user_roles ur ON ur.role_id = r.id
+WHERE ur.user_id = $1
+ORDER BY r.name;
+
+-- name: GrantRolePermissions :execrows
+-- Grants the named permissions that exist; unknown names are skipped, so
+-- callers compare the count with what they asked for.
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT sqlc.arg(role_id), p.id
+FROM permissions p
+WHERE p.name = ANY(sqlc.arg(names)::text[])
+ON CONFLICT DO NOTHING;
+
+-- name: ListPermissions :many
+SELECT * FROM permissions ORDER BY name;
+
+-- name: ListRoles :many
+SELECT r.id, r.name, r.description, r.created_at,
+       COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')::text[] AS permissions,
+       (SELECT COUNT(*) FROM user_roles ur WHERE ur.role_id = r.id) AS member_count
+FROM roles r
+LEFT JOIN role_permissions rp ON rp.role_id = r.id
+LEFT JOIN permissions p ON p.id = rp.permission_id
+GROUP BY r.id
+ORDER BY r.name;
+
+-- name: LockRole :exec
+-- Serializes changes to a role's membership until the transaction ends.
+SELECT id FROM roles WHERE id = $1 FOR UPDATE;
+
+-- name: UpdateRole :one
+UPDATE roles
+SET name = $2, description = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: UpsertPermission :exec
+INSERT INTO permissions (name, description)
+VALUES ($1, $2)
+ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description;
@@ -0,0 +1,79 @@
+-- name: GetSessionByRefreshTokenHash :one
+SELECT * FROM sessions
+WHERE refresh_token_hash = $1;
+
+-- name: RotateSessionToken :one
+UPDATE sessions
+SET refresh_token_hash = sqlc.arg(new_refresh_token_hash),
+    expires_at = sqlc.arg(expires_at),
+    updated_at = now()
+WHERE id = sqlc.arg(id)
+  AND refresh_token_hash = sqlc.arg(old_refresh_token_hash)
+  AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = now(),
+    updated_at = now()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserSessions :execrows
+UPDATE sessions
+SET revoked_at = now(),
+    updated_at = now()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeOtherUserSessions :execrows
+UPDATE sessions
+SET revoked_at = now(),
+    updated_at = now()
+WHERE user_id = sqlc.arg(user_id)
+  AND id IS DISTINCT FROM sqlc.arg(keep_session_id)
+  AND revoked_at IS NULL;
+
+-- name: GetActiveSession :one
+SELECT * FROM sessions
+WHERE id = $1
+  AND user_id = $2
+  AND revoked_at IS NULL
+  AND expires_at > now();
+
+-- name: ListUnhashedSessions :many
+SELECT id, refresh_token FROM sessions
+WHERE refresh_token_hash IS NULL AND refresh_token IS NOT NULL;
+
+-- name: SetSessionRefreshTokenHash :exec
+UPDATE sessions
+SET refresh_token_hash = $2,
+    refresh_token = NULL
+WHERE id = $1;
+
+-- name: AttachSessionDevice :exec
+UPDATE sessions
+SET device_id = $2
+WHERE id = $1;
+
+-- name: ListActiveSessionsByUser :many
+SELECT
+    s.id,
+    s.created_at,
+    s.updated_at,
+    s.expires_at,
+    d.id AS device_id,
+    d.device_name,
+    d.device_type,
+    d.ip_address,
+    d.last_seen
+FROM sessions s
+LEFT JOIN devices d ON d.id = s.device_id
+WHERE s.user_id = $1
+  AND s.revoked_at IS NULL
+  AND s.expires_at > now()
+ORDER BY s.updated_at DESC;
+
+-- name: ListSessionsByUser :many
+SELECT id, device_id, created_at, updated_at, expires_at, revoked_at
+FROM sessions
+WHERE user_id = $1
+ORDER BY created_at;
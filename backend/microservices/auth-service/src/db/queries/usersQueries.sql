@@ -2,8 +2,8 @@
 SELECT * FROM users WHERE email = $1;
 
 -- name: CreateUser :one
-INSERT INTO users (email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO users (email, password_hash, oauth_provider, oauth_provider_id, mfa_enabled, email_verified)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING *;
 
 -- name: FindRoleByName :one
@@ -22,23 +22,26 @@ INSERT INTO roles (
 RETURNING id, name, description, created_at;
 
 -- name: CreateUserRole :one
+-- Assigning a role the user already has returns the existing assignment.
 INSERT INTO user_roles (
     user_id,
     role_id
 ) VALUES (
     $1, $2
 )
+ON CONFLICT (user_id, role_id) DO UPDATE SET assigned_at = user_roles.assigned_at
 RETURNING id, user_id, role_id, assigned_at;
 
 -- name: CreateSession :one
 INSERT INTO sessions (
+    id,
     user_id,
-    refresh_token,
+    refresh_token_hash,
     expires_at
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4
 )
-RETURNING id, user_id, refresh_token, expires_at, created_at, updated_at;
+RETURNING id, user_id, refresh_token, expires_at, created_at, updated_at, revoked_at, refresh_token_hash, device_id;
 
 -- name: CreateDevice :one
 INSERT INTO devices (
@@ -70,6 +73,7 @@ WHERE oauth_provider = $1 AND oauth_provider_id = $2;
 SELECT 
     u.id as user_id, 
     u.email, 
+    u.email_verified,
     u.created_at as user_created_at,
     d.device_name, 
     d.last_seen
@@ -77,4 +81,68 @@ FROM users u
 LEFT JOIN devices d ON u.id = d.user_id
 WHERE u.id = $1
 ORDER BY d.last_seen DESC
-LIMIT 1;
\ No newline at end of file
+LIMIT 1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified = TRUE,
+    email_verified_at = COALESCE(email_verified_at, now()),
+    updated_at = now()
+WHERE id = $1;
+
+-- name: ClaimVerificationEmailSlot :execrows
+-- Throttles verification emails: only matches when the cooldown since the
+-- last email has passed, and records the new send time.
+UPDATE users
+SET verification_sent_at = now()
+WHERE id = sqlc.arg(id)
+  AND email_verified = FALSE
+  AND (verification_sent_at IS NULL
+       OR verification_sent_at < now() - make_interval(secs => sqlc.arg(cooldown_seconds)::int));
+
+-- name: ListDevicesByUser :many
+SELECT * FROM devices
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: ListUsers :many
+-- Newest first, for the admin console. Filters left NULL match everything;
+-- with a cursor the page starts after that (created_at, id), which is why
+-- created_at is NOT NULL.
+SELECT
+    u.id,
+    u.email,
+    u.oauth_provider,
+    u.mfa_enabled,
+    u.risk_score,
+    u.email_verified,
+    u.created_at,
+    u.deletion_scheduled_for,
+    COALESCE((
+        SELECT array_agg(r.name ORDER BY r.name)
+        FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = u.id
+    ), '{}')::text[] AS roles
+FROM users u
+WHERE u.deleted_at IS NULL
+  AND (sqlc.narg(email_prefix)::text IS NULL OR starts_with(lower(u.email), lower(sqlc.narg(email_prefix))))
+  AND (sqlc.narg(provider)::text IS NULL OR COALESCE(u.oauth_provider, 'password') = sqlc.narg(provider))
+  AND (sqlc.narg(role)::text IS NULL OR EXISTS (
+        SELECT 1
+        FROM user_roles ur
+        JOIN roles r ON r.id = ur.role_id
+        WHERE ur.user_id = u.id AND r.name = sqlc.narg(role)
+      ))
+  AND (sqlc.narg(created_after)::timestamp IS NULL OR u.created_at >= sqlc.narg(created_after))
+  AND (sqlc.narg(created_before)::timestamp IS NULL OR u.created_at < sqlc.narg(created_before))
+  AND (sqlc.narg(min_risk)::int IS NULL OR COALESCE(u.risk_score, 0) >= sqlc.narg(min_risk))
+  AND (sqlc.narg(max_risk)::int IS NULL OR COALESCE(u.risk_score, 0) <= sqlc.narg(max_risk))
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+       OR (u.created_at, u.id) < (sqlc.narg(cursor_created_at), sqlc.narg(cursor_id)::uuid))
+ORDER BY u.created_at DESC, u.id DESC
+LIMIT sqlc.arg(page_size);
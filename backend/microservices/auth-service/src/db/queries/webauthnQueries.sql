@@ -0,0 +1,58 @@
+-- name: CreateWebauthnCeremony :one
+INSERT INTO webauthn_ceremonies (
+    user_id,
+    kind,
+    session_data,
+    expires_at
+) VALUES (
+    $1, $2, $3, $4
+)
+RETURNING id;
+
+-- name: TakeWebauthnCeremony :one
+DELETE FROM webauthn_ceremonies
+WHERE id = $1 AND kind = $2 AND expires_at > now()
+RETURNING *;
+
+-- name: DeleteExpiredWebauthnCeremonies :execrows
+DELETE FROM webauthn_ceremonies
+WHERE expires_at <= now();
+
+-- name: CreateWebauthnCredential :one
+INSERT INTO webauthn_credentials (
+    user_id,
+    credential_id,
+    public_key,
+    attestation_type,
+    aaguid,
+    sign_count,
+    backup_eligible,
+    backup_state,
+    transports,
+    attachment,
+    name
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+)
+RETURNING *;
+
+-- name: ListWebauthnCredentialsByUser :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetWebauthnCredentialByCredentialID :one
+SELECT * FROM webauthn_credentials
+WHERE credential_id = $1;
+
+-- name: UpdateWebauthnCredentialUsage :exec
+UPDATE webauthn_credentials
+SET sign_count = $2,
+    clone_warning = $3,
+    backup_state = $4,
+    last_used_at = now()
+WHERE id = $1;
+
+-- name: DeleteWebauthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE id = $1 AND user_id = $2;
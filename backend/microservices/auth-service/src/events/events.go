@@ -0,0 +1,70 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"auth-service/src/config"
+)
+
+// Event types other services subscribe to
+const (
+	// UserDeleted is published once an account is purged. Consumers must
+	// drop everything they hold for data.user_id.
+	UserDeleted = "user.deleted"
+)
+
+// Event is the envelope every event is delivered in. Delivery is at least
+// once, so consumers should deduplicate on ID.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// NewEvent wraps data in an envelope with a fresh ID
+func NewEvent(eventType string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       raw,
+	}, nil
+}
+
+// Publisher delivers events to other services. Implementations must be safe
+// for concurrent use.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// New builds the publisher selected by the configuration
+func New(cfg config.EventsConfig) (Publisher, error) {
+	switch cfg.Driver {
+	case "log":
+		return LogPublisher{}, nil
+	case "webhook":
+		return NewWebhookPublisher(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown events driver %q", cfg.Driver)
+	}
+}
+
+// LogPublisher writes events to the service log instead of delivering them.
+// It is meant for local development.
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(ctx context.Context, event Event) error {
+	log.Printf("[LogPublisher] %s %s: %s", event.Type, event.ID, event.Data)
+	return nil
+}
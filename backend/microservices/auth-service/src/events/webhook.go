@@ -0,0 +1,81 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-service/src/config"
+)
+
+// WebhookPublisher POSTs each event to every configured URL. Receivers
+// verify X-Signature, which is "sha256=" followed by the hex HMAC-SHA256 of
+// "<X-Signature-Timestamp>.<body>" under the shared secret.
+type WebhookPublisher struct {
+	urls   []string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookPublisher builds a webhook publisher from the events configuration
+func NewWebhookPublisher(cfg config.EventsConfig) *WebhookPublisher {
+	return &WebhookPublisher{
+		urls:   cfg.WebhookURLs,
+		secret: []byte(cfg.WebhookSecret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Publish succeeds only when every receiver accepted the event. On failure
+// the whole event is retried later, so a receiver can see it more than once.
+func (p *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	for _, url := range p.urls {
+		if err := p.post(ctx, url, event, body, timestamp, signature); err != nil {
+			return fmt.Errorf("deliver %s to %s: %w", event.ID, url, err)
+		}
+	}
+	return nil
+}
+
+func (p *WebhookPublisher) post(ctx context.Context, url string, event Event, body []byte, timestamp, signature string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-ID", event.ID)
+	req.Header.Set("X-Event-Type", event.Type)
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature", signature)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
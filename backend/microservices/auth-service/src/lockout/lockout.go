@@ -0,0 +1,116 @@
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"auth-service/src/config"
+)
+
+// Store keeps failure counters somewhere every replica can see them.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// RetryAfter is how long the longest block among keys still lasts
+	RetryAfter(ctx context.Context, keys []string) (time.Duration, error)
+
+	// RecordFailure counts a failure and returns the new total. The count
+	// starts over when the previous failure is older than window.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+
+	// Block refuses attempts on key for d. lock marks the block as a lockout.
+	Block(ctx context.Context, key string, d time.Duration, lock bool) error
+
+	// Reset forgets everything about key
+	Reset(ctx context.Context, key string) error
+
+	// Unlock lifts a lockout that started no later than lockedBefore
+	Unlock(ctx context.Context, key string, lockedBefore time.Time) (bool, error)
+}
+
+// Guard applies the lockout policy to login attempts
+type Guard struct {
+	store   Store
+	account config.LockoutLimits
+	ip      config.LockoutLimits
+}
+
+func NewGuard(store Store, cfg config.LockoutConfig) *Guard {
+	return &Guard{store: store, account: cfg.Account, ip: cfg.IP}
+}
+
+// Check returns how long the caller has to wait before trying to log in to
+// email from ip, or zero when the attempt may go ahead.
+func (g *Guard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	return g.store.RetryAfter(ctx, []string{accountKey(email), ipKey(ip)})
+}
+
+// Fail records a failed login. locked reports that this very failure locked
+// the address, so the owner can be told once.
+func (g *Guard) Fail(ctx context.Context, email, ip string) (locked bool, err error) {
+	if _, err := g.fail(ctx, ipKey(ip), g.ip); err != nil {
+		return false, err
+	}
+	return g.fail(ctx, accountKey(email), g.account)
+}
+
+func (g *Guard) fail(ctx context.Context, key string, limits config.LockoutLimits) (bool, error) {
+	failures, err := g.store.RecordFailure(ctx, key, limits.Window)
+	if err != nil {
+		return false, err
+	}
+
+	delay, lock := Delay(limits, failures)
+	if delay == 0 {
+		return false, nil
+	}
+	if err := g.store.Block(ctx, key, delay, lock); err != nil {
+		return false, err
+	}
+	return lock && failures == int(limits.Threshold), nil
+}
+
+// Succeed clears the account's failures after a correct password. The IP's
+// are kept, or an attacker could reset them by logging in to an account of
+// their own between guesses.
+func (g *Guard) Succeed(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email))
+}
+
+// Unlock lifts the lockout on email if it began no later than lockedBefore,
+// the time the unlock link was issued
+func (g *Guard) Unlock(ctx context.Context, email string, lockedBefore time.Time) (bool, error) {
+	return g.store.Unlock(ctx, accountKey(email), lockedBefore)
+}
+
+// Reset clears every failure and block on email, for when the owner has
+// proven themselves another way or an administrator steps in
+func (g *Guard) Reset(ctx context.Context, email string) error {
+	return g.store.Reset(ctx, accountKey(email))
+}
+
+// Delay is how long attempts are refused after the given number of
+// consecutive failures, and whether that counts as a lockout
+func Delay(limits config.LockoutLimits, failures int) (time.Duration, bool) {
+	if failures >= int(limits.Threshold) {
+		return limits.LockDuration, true
+	}
+	excess := failures - int(limits.FreeAttempts)
+	if excess <= 0 {
+		return 0, false
+	}
+
+	delay := limits.BaseDelay
+	for i := 1; i < excess && delay < limits.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, limits.MaxDelay), false
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
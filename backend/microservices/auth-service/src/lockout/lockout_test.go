@@ -0,0 +1,181 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-service/src/config"
+)
+
+var testLimits = config.LockoutLimits{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     time.Minute,
+	Threshold:    10,
+	LockDuration: 15 * time.Minute,
+	Window:       time.Hour,
+}
+
+func TestDelay(t *testing.T) {
+	capped := testLimits
+	capped.MaxDelay = 5 * time.Second
+
+	tests := []struct {
+		name     string
+		limits   config.LockoutLimits
+		failures int
+		delay    time.Duration
+		lock     bool
+	}{
+		{"no failures", testLimits, 0, 0, false},
+		{"last free attempt", testLimits, 3, 0, false},
+		{"first delay", testLimits, 4, time.Second, false},
+		{"doubles", testLimits, 5, 2 * time.Second, false},
+		{"keeps doubling", testLimits, 9, 32 * time.Second, false},
+		{"threshold locks", testLimits, 10, 15 * time.Minute, true},
+		{"past threshold stays locked", testLimits, 25, 15 * time.Minute, true},
+		{"capped", capped, 7, 5 * time.Second, false},
+		{"cap between doublings", capped, 6, 4 * time.Second, false},
+		{"no free attempts", config.LockoutLimits{BaseDelay: time.Second, MaxDelay: time.Minute, Threshold: 5}, 1, time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, lock := Delay(tt.limits, tt.failures)
+			if delay != tt.delay || lock != tt.lock {
+				t.Errorf("Delay(%d) = %v, %v; want %v, %v", tt.failures, delay, lock, tt.delay, tt.lock)
+			}
+		})
+	}
+}
+
+// memoryStore is a Store without clocks: a block lasts until reset
+type memoryStore struct {
+	failures map[string]int
+	blocks   map[string]time.Duration
+	locked   map[string]bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{failures: map[string]int{}, blocks: map[string]time.Duration{}, locked: map[string]bool{}}
+}
+
+func (s *memoryStore) RetryAfter(_ context.Context, keys []string) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range keys {
+		longest = max(longest, s.blocks[key])
+	}
+	return longest, nil
+}
+
+func (s *memoryStore) RecordFailure(_ context.Context, key string, _ time.Duration) (int, error) {
+	s.failures[key]++
+	return s.failures[key], nil
+}
+
+func (s *memoryStore) Block(_ context.Context, key string, d time.Duration, lock bool) error {
+	s.blocks[key] = d
+	s.locked[key] = lock
+	return nil
+}
+
+func (s *memoryStore) Reset(_ context.Context, key string) error {
+	delete(s.failures, key)
+	delete(s.blocks, key)
+	delete(s.locked, key)
+	return nil
+}
+
+func (s *memoryStore) Unlock(_ context.Context, key string, _ time.Time) (bool, error) {
+	if !s.locked[key] {
+		return false, nil
+	}
+	return true, s.Reset(context.Background(), key)
+}
+
+func TestGuard(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	ipLimits := testLimits
+	ipLimits.FreeAttempts, ipLimits.Threshold = 20, 100
+	guard := NewGuard(store, config.LockoutConfig{Account: testLimits, IP: ipLimits})
+
+	fail := func(email string) bool {
+		t.Helper()
+		locked, err := guard.Fail(ctx, email, "10.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return locked
+	}
+	wait := func(email, ip string) time.Duration {
+		t.Helper()
+		d, err := guard.Check(ctx, email, ip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	for range testLimits.FreeAttempts {
+		fail("ada@example.com")
+	}
+	if d := wait("ada@example.com", "10.0.0.1"); d != 0 {
+		t.Fatalf("blocked for %v within the free attempts", d)
+	}
+
+	// Addresses are compared without case or surrounding space
+	fail(" Ada@Example.com")
+	if d := wait("ada@example.com", "10.0.0.2"); d != time.Second {
+		t.Fatalf("blocked for %v, want 1s", d)
+	}
+
+	// Only the failure that reaches the threshold reports the lockout
+	var lockedAt []int
+	for i := testLimits.FreeAttempts + 2; i <= testLimits.Threshold+2; i++ {
+		if fail("ada@example.com") {
+			lockedAt = append(lockedAt, int(i))
+		}
+	}
+	if len(lockedAt) != 1 || lockedAt[0] != int(testLimits.Threshold) {
+		t.Errorf("lockout reported at failures %v, want only %d", lockedAt, testLimits.Threshold)
+	}
+	if d := wait("ada@example.com", "10.0.0.2"); d != testLimits.LockDuration {
+		t.Errorf("blocked for %v, want the lock duration", d)
+	}
+
+	// Another account behind the same address is only slowed by the IP
+	if d := wait("grace@example.com", "10.0.0.1"); d != 0 {
+		t.Errorf("other account blocked for %v", d)
+	}
+
+	// Success clears the account but not the address
+	if err := guard.Succeed(ctx, "ada@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if d := wait("ada@example.com", "10.0.0.2"); d != 0 {
+		t.Errorf("still blocked for %v after success", d)
+	}
+	if got := store.failures[ipKey("10.0.0.1")]; got != int(testLimits.Threshold)+2 {
+		t.Errorf("address has %d failures, want them kept", got)
+	}
+}
+
+func TestGuardUnlock(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	guard := NewGuard(store, config.LockoutConfig{Account: testLimits, IP: testLimits})
+
+	if ok, _ := guard.Unlock(ctx, "ada@example.com", time.Now()); ok {
+		t.Error("unlocked an account that was not locked")
+	}
+	for range testLimits.Threshold {
+		guard.Fail(ctx, "ada@example.com", "10.0.0.1")
+	}
+	if ok, err := guard.Unlock(ctx, "ADA@example.com", time.Now()); !ok || err != nil {
+		t.Fatalf("Unlock = %v, %v", ok, err)
+	}
+	if d, _ := guard.Check(ctx, "ada@example.com", "10.0.0.2"); d != 0 {
+		t.Errorf("blocked for %v after unlock", d)
+	}
+}
@@ -0,0 +1,59 @@
+package lockout
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	generated "auth-service/src/db/generated"
+)
+
+// PostgresStore keeps the counters in the login_throttles table. Times are
+// taken from the database clock so replicas with drifting clocks agree.
+type PostgresStore struct {
+	db *generated.Queries
+}
+
+func NewPostgresStore(db *generated.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) RetryAfter(ctx context.Context, keys []string) (time.Duration, error) {
+	seconds, err := s.db.GetLoginRetryAfter(ctx, keys)
+	return time.Duration(seconds) * time.Second, err
+}
+
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	failures, err := s.db.RecordLoginFailure(ctx, generated.RecordLoginFailureParams{
+		Key:           key,
+		WindowSeconds: seconds(window),
+	})
+	return int(failures), err
+}
+
+func (s *PostgresStore) Block(ctx context.Context, key string, d time.Duration, lock bool) error {
+	return s.db.BlockLogin(ctx, generated.BlockLoginParams{
+		Seconds: seconds(d),
+		Lock:    lock,
+		Key:     key,
+	})
+}
+
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	return s.db.ResetLoginThrottle(ctx, key)
+}
+
+func (s *PostgresStore) Unlock(ctx context.Context, key string, lockedBefore time.Time) (bool, error) {
+	n, err := s.db.UnlockLogin(ctx, generated.UnlockLoginParams{
+		Key:          key,
+		LockedBefore: pgtype.Timestamp{Time: lockedBefore, Valid: true},
+	})
+	return n > 0, err
+}
+
+// seconds rounds up, so a sub-second delay still blocks
+func seconds(d time.Duration) int32 {
+	return int32(math.Ceil(d.Seconds()))
+}
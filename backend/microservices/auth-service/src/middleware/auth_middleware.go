@@ -1,47 +1,128 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5/pgtype"
 
-	// Replace these with the actual paths in your project
 	jwt "auth-service/src/utils"
 )
 
+const bearerRealm = "auth-service"
+
+var (
+	// ErrNoBearerToken means the request carries no Authorization header
+	ErrNoBearerToken = errors.New("no bearer token")
+
+	// ErrMalformedBearerToken means an Authorization header is present but is
+	// not a well-formed "Bearer <token>" credential
+	ErrMalformedBearerToken = errors.New("malformed bearer token")
+)
+
+// AuthMiddleware authenticates the caller with an access token taken from
+// either the Authorization header or the access_token cookie.
+//
+// The header wins: when an Authorization header is present the cookie is
+// ignored, even if the header turns out to be invalid. Native clients that
+// send a header never get silently authenticated as whoever owns a stale
+// browser cookie. Failures follow RFC 6750 and carry a WWW-Authenticate header.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 1. Get token from cookie
-		tokenString, err := c.Cookie("access_token")
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-			c.Abort()
+		// 1. Get token from the Authorization header, falling back to the cookie
+		tokenString, err := BearerToken(c.Request)
+		if errors.Is(err, ErrMalformedBearerToken) {
+			bearerError(c, http.StatusBadRequest, "invalid_request", "Authorization header must use the Bearer scheme")
 			return
 		}
+		if errors.Is(err, ErrNoBearerToken) {
+			tokenString, err = c.Cookie("access_token")
+			if err != nil || tokenString == "" {
+				// No credentials at all: RFC 6750 §3.1 says not to include an error code
+				c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, bearerRealm))
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+				return
+			}
+		}
 
-		// 2. Parse & Validate
-		// claims should contain the UserID (string)
-		claims, err := jwt.ValidateToken(tokenString)
+		// 2. Parse & validate; only access tokens authenticate requests
+		claims, err := jwt.ValidateToken(tokenString, jwt.AudienceAuth)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			bearerError(c, http.StatusUnauthorized, "invalid_token", "The access token is invalid or expired")
+			return
+		}
+		if claims.Type != "access" {
+			bearerError(c, http.StatusUnauthorized, "invalid_token", "The token is not an access token")
 			return
 		}
 
-		// 3. Convert string ID back to pgtype.UUID
-		// This format is required for pgx to handle the binary UUID correctly
-		var userUUID pgtype.UUID
-		err = userUUID.UnmarshalJSON([]byte(fmt.Sprintf("\"%s\"", claims.UserID)))
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal ID mapping error"})
-			c.Abort()
+		// 3. Save to context for the controller to find
+		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("restricted", claims.Restricted)
+		c.Set("roles", claims.Roles)
+		c.Set("scopes", claims.Scopes())
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail rejects restricted access tokens, which are issued to
+// users who have not verified their email address yet. It must run after
+// AuthMiddleware.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("restricted") {
+			bearerError(c, http.StatusForbidden, "insufficient_scope", "Verify your email address to use this endpoint")
 			return
 		}
+		c.Next()
+	}
+}
 
-		// 4. Save to context for the controller to find
-		c.Set("user_id", userUUID)
+// RequireScope rejects access tokens that were not issued with every one of
+// the scopes. It reads the token alone, so it costs no database lookup, but
+// role changes only reach it once the token is refreshed; RequirePermission
+// is the immediate alternative. It must run after AuthMiddleware.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	required := strings.Join(scopes, " ")
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("scopes")
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="insufficient_scope", scope=%q`, bearerRealm, required))
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error":      "The access token lacks a required scope",
+					"error_code": "insufficient_scope",
+					"scope":      required,
+				})
+				return
+			}
+		}
 		c.Next()
 	}
 }
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>"
+// header. The scheme is matched case-insensitively (RFC 7235 §2.1).
+func BearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrNoBearerToken
+	}
+
+	scheme, token, ok := strings.Cut(header, " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" || strings.Contains(token, " ") {
+		return "", ErrMalformedBearerToken
+	}
+	return token, nil
+}
+
+// bearerError aborts with an RFC 6750 §3 error response
+func bearerError(c *gin.Context, status int, code, description string) {
+	c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error=%q, error_description=%q`, bearerRealm, code, description))
+	c.AbortWithStatusJSON(status, gin.H{"error": description, "error_code": code})
+}
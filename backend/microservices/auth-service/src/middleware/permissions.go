@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// permissionsKey is where the caller's resolved permissions are kept on the
+// gin context, so several checks in one request hit the database once
+const permissionsKey = "permissions"
+
+// PermissionSource resolves a user's effective permissions. The generated
+// db.Queries satisfies it.
+type PermissionSource interface {
+	GetUserPermissions(ctx context.Context, userID pgtype.UUID) ([]string, error)
+}
+
+var (
+	permissionSource PermissionSource
+
+	errNoUser = errors.New("no authenticated user")
+)
+
+// InitPermissions sets where RequirePermission looks permissions up. Call it
+// once at startup, before serving requests.
+func InitPermissions(source PermissionSource) {
+	permissionSource = source
+}
+
+// RequirePermission rejects callers whose roles do not grant permission. It
+// must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permissions, err := Permissions(c)
+		if errors.Is(err, errNoUser) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if err != nil {
+			log.Printf("DATABASE ERROR in GetUserPermissions: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return
+		}
+		if !permissions[permission] {
+			bearerError(c, http.StatusForbidden, "insufficient_scope", "You do not have permission to use this endpoint")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Permissions returns the set of permissions the authenticated caller holds,
+// loading them on first use in the request
+func Permissions(c *gin.Context) (map[string]bool, error) {
+	if cached, ok := c.Get(permissionsKey); ok {
+		return cached.(map[string]bool), nil
+	}
+
+	val, ok := c.Get("user_id")
+	userID, _ := val.(pgtype.UUID)
+	if !ok || !userID.Valid {
+		return nil, errNoUser
+	}
+	if permissionSource == nil {
+		return nil, errors.New("permissions are not initialized")
+	}
+
+	names, err := permissionSource.GetUserPermissions(c.Request.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := make(map[string]bool, len(names))
+	for _, name := range names {
+		permissions[name] = true
+	}
+	c.Set(permissionsKey, permissions)
+	return permissions, nil
+}
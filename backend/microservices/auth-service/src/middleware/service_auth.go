@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceAuth protects endpoints meant for other backend services, such as
+// token introspection. Callers present the shared secret either as a
+// bearer token or as the password of HTTP Basic credentials.
+func ServiceAuth(secret string) gin.HandlerFunc {
+	if secret == "" {
+		log.Println("[ServiceAuth] No introspection secret configured, service endpoints are unauthenticated")
+	}
+
+	return func(c *gin.Context) {
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		var presented string
+		if _, password, ok := c.Request.BasicAuth(); ok {
+			presented = password
+		} else if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			presented = strings.TrimPrefix(header, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(secret)) != 1 {
+			c.Header("WWW-Authenticate", `Basic realm="auth-service"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Service credentials required"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,177 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Hashes in the Have I Been Pwned corpus are upper-case hex SHA-1. Range
+// files are named by the first five characters and hold the remaining 35.
+const (
+	hashLength   = 40
+	prefixLength = 5
+
+	// searchWindow is where the binary search over a sorted file hands over
+	// to a linear scan. It must hold many lines so every probe finds one.
+	searchWindow = 8 << 10
+)
+
+// corpus looks up how often a password appears in known breaches
+type corpus interface {
+	count(password string) (int, error)
+}
+
+func openCorpus(path string) (corpus, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return rangeDir(path), nil
+	}
+	return sortedFile(path), nil
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// parseLine splits a "HASH:COUNT" line. Padding entries with a count of
+// zero are reported as such.
+func parseLine(line string) (string, int, bool) {
+	key, rawCount, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok {
+		return "", 0, false
+	}
+	count, err := strconv.Atoi(rawCount)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToUpper(key), count, true
+}
+
+// rangeDir is a directory of range files as written by the official
+// downloader: 21BD1.txt holds "SUFFIX:COUNT" lines for hashes starting 21BD1.
+// Only the one file a password falls into is read.
+type rangeDir string
+
+func (d rangeDir) count(password string) (int, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(string(d), prefix+".txt"))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.Open(filepath.Join(string(d), prefix))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key, count, ok := parseLine(scanner.Text()); ok && key == suffix {
+			return count, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// sortedFile is a single file of "HASH:COUNT" lines in hash order, searched
+// in place so the multi-gigabyte corpus never has to fit in memory.
+type sortedFile string
+
+func (s sortedFile) count(password string) (int, error) {
+	hash := sha1Hex(password)
+
+	f, err := os.Open(string(s))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// Narrow [lo, hi] down to a window that holds the line for hash, if any
+	lo, hi := int64(0), info.Size()
+	for hi-lo > searchWindow {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineFrom(f, mid)
+		if err != nil {
+			return 0, err
+		}
+		key, _, ok := parseLine(line)
+		if !ok || start >= hi {
+			hi = mid
+			continue
+		}
+		if key < hash {
+			lo = mid
+		} else {
+			hi = start
+		}
+	}
+
+	reader := io.NewSectionReader(f, 0, info.Size())
+	start, _, err := lineFrom(f, lo)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := reader.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		key, count, ok := parseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if key == hash {
+			return count, nil
+		}
+		if key > hash {
+			return 0, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// lineFrom returns the first whole line starting at or after offset and
+// where it starts. At the end of the file the line is empty.
+func lineFrom(f *os.File, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		start = offset - 1
+	}
+	reader := bufio.NewReader(io.NewSectionReader(f, start, 1<<62))
+	if offset > 0 {
+		skipped, err := reader.ReadString('\n')
+		if err == io.EOF {
+			return start + int64(len(skipped)), "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, line, nil
+}
@@ -0,0 +1,122 @@
+package password
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// breachedPasswords are "breached-0" ... with counts 1, 2, ...; enough that
+// the sorted file spans many search windows
+const breachedPasswords = 2000
+
+// writeSortedCorpus writes the breached passwords as one sorted file, with a
+// padding entry of count zero after every tenth line
+func writeSortedCorpus(t *testing.T, newline string) string {
+	t.Helper()
+	var lines []string
+	for i := range breachedPasswords {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(fmt.Sprintf("breached-%d", i)), i+1))
+		if i%10 == 0 {
+			lines = append(lines, fmt.Sprintf("%s:0", sha1Hex(fmt.Sprintf("padding-%d", i))))
+		}
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, newline)+newline), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeRangeDir writes the breached passwords as range files
+func writeRangeDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	ranges := map[string][]string{}
+	for i := range breachedPasswords {
+		hash := sha1Hex(fmt.Sprintf("breached-%d", i))
+		prefix := hash[:prefixLength]
+		ranges[prefix] = append(ranges[prefix], fmt.Sprintf("%s:%d", hash[prefixLength:], i+1))
+	}
+	for prefix, lines := range ranges {
+		sort.Strings(lines)
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(lines, "\r\n")), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCorpusCount(t *testing.T) {
+	corpora := []struct {
+		name string
+		path func(*testing.T) string
+	}{
+		{"sorted file", func(t *testing.T) string { return writeSortedCorpus(t, "\n") }},
+		{"sorted file with CRLF", func(t *testing.T) string { return writeSortedCorpus(t, "\r\n") }},
+		{"range directory", writeRangeDir},
+	}
+	for _, tc := range corpora {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := openCorpus(tc.path(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Every entry is found, wherever the search lands around it
+			for i := range breachedPasswords {
+				password := fmt.Sprintf("breached-%d", i)
+				if got, err := c.count(password); err != nil || got != i+1 {
+					t.Fatalf("count(%q) = %d, %v, want %d", password, got, err, i+1)
+				}
+			}
+
+			for _, password := range []string{"never-breached", "padding-10", "", strings.Repeat("x", 200)} {
+				if got, err := c.count(password); err != nil || got != 0 {
+					t.Errorf("count(%q) = %d, %v, want 0", password, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSortedFileEdges(t *testing.T) {
+	first, last := sha1Hex("first"), sha1Hex("last")
+	if first > last {
+		first, last = last, first
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{"empty file", nil},
+		{"single line", []string{first + ":7"}},
+		{"no trailing newline", []string{first + ":7", last + ":9"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "corpus.txt")
+			if err := os.WriteFile(path, []byte(strings.Join(tt.lines, "\n")), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]int{}
+			for _, line := range tt.lines {
+				hash, count, _ := parseLine(line)
+				want[hash] = count
+			}
+
+			for _, password := range []string{"first", "last", "missing"} {
+				got, err := sortedFile(path).count(password)
+				if err != nil || got != want[sha1Hex(password)] {
+					t.Errorf("count(%q) = %d, %v, want %d", password, got, err, want[sha1Hex(password)])
+				}
+			}
+		})
+	}
+}
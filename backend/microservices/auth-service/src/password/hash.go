@@ -0,0 +1,178 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-service/src/config"
+)
+
+// Hashing algorithms a Hasher can produce
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+// ErrTooLong is returned by Hash when the algorithm cannot take the whole
+// password; bcrypt ignores everything past 72 bytes.
+var ErrTooLong = errors.New("password is too long for the hashing algorithm")
+
+var errMalformedHash = errors.New("malformed password hash")
+
+// ResetRequired is stored in place of a hash when an administrator forces a
+// password reset. It matches no password, but the account still counts as
+// having one, so the user gets back in through the normal reset flow.
+const ResetRequired = "!reset-required"
+
+// argon2Params are the tunables stored in every argon2id hash
+type argon2Params struct {
+	memory      uint32 // KiB
+	iterations  uint32
+	parallelism uint8
+	saltLength  uint32
+	keyLength   uint32
+}
+
+// Hasher hashes new passwords with the configured algorithm and verifies
+// stored ones whatever they were hashed with. Hashes are self-describing:
+// argon2id uses the PHC string format
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+//
+// and bcrypt its usual $2a$<cost>$... form.
+type Hasher struct {
+	algorithm  string
+	argon2     argon2Params
+	bcryptCost int
+
+	dummyOnce sync.Once
+	dummy     string
+}
+
+// NewHasher builds a hasher from the configuration
+func NewHasher(cfg config.PasswordHashConfig) (*Hasher, error) {
+	h := &Hasher{
+		algorithm: cfg.Algorithm,
+		argon2: argon2Params{
+			memory:      uint32(cfg.Argon2.Memory),
+			iterations:  uint32(cfg.Argon2.Iterations),
+			parallelism: uint8(cfg.Argon2.Parallelism),
+			saltLength:  uint32(cfg.Argon2.SaltLength),
+			keyLength:   uint32(cfg.Argon2.KeyLength),
+		},
+		bcryptCost: int(cfg.BcryptCost),
+	}
+	switch h.algorithm {
+	case AlgorithmArgon2id, AlgorithmBcrypt:
+		return h, nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", h.algorithm)
+	}
+}
+
+// Hash returns the encoded hash of a new password
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return "", ErrTooLong
+		}
+		return string(hash), err
+	}
+
+	p := h.argon2
+	salt := make([]byte, p.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, p.keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether password matches the stored hash and, if it does,
+// whether the hash should be replaced because it was made with another
+// algorithm or other parameters than are configured now.
+func (h *Hasher) Verify(password, encoded string) (match, rehash bool, err error) {
+	if encoded == ResetRequired {
+		h.VerifyDummy(password)
+		return false, false, nil
+	}
+
+	if strings.HasPrefix(encoded, "$argon2id$") {
+		p, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, false, err
+		}
+		candidate := argon2.IDKey([]byte(password), salt, p.iterations, p.memory, p.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return false, false, nil
+		}
+		wanted := h.argon2
+		p.saltLength, p.keyLength = uint32(len(salt)), uint32(len(key))
+		return true, h.algorithm != AlgorithmArgon2id || p != wanted, nil
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return false, false, err
+	}
+	return true, h.algorithm != AlgorithmBcrypt || cost != h.bcryptCost, nil
+}
+
+// VerifyDummy spends as long as Verify on a hash that matches nothing. Use
+// it when there is no stored hash to check, so the response time does not
+// tell whether an account exists.
+func (h *Hasher) VerifyDummy(password string) {
+	h.dummyOnce.Do(func() {
+		h.dummy, _ = h.Hash("no account has this password")
+	})
+	h.Verify(password, h.dummy)
+}
+
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, nil, nil, errMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	var p argon2Params
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+	if err != nil || p.iterations == 0 || p.parallelism == 0 {
+		return argon2Params{}, nil, nil, errMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, errMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, errMalformedHash
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,121 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"auth-service/src/config"
+)
+
+// Cheap settings so the tests stay fast; only how they differ matters
+var (
+	argon2Cheap = config.Argon2Config{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	argon2More  = config.Argon2Config{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+)
+
+func newTestHasher(t *testing.T, algorithm string, argon config.Argon2Config, bcryptCost int32) *Hasher {
+	t.Helper()
+	h, err := NewHasher(config.PasswordHashConfig{Algorithm: algorithm, Argon2: argon, BcryptCost: bcryptCost})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestVerifyRehash(t *testing.T) {
+	hashers := map[string]*Hasher{
+		"argon2id":       newTestHasher(t, AlgorithmArgon2id, argon2Cheap, 4),
+		"argon2id t=2":   newTestHasher(t, AlgorithmArgon2id, argon2More, 4),
+		"argon2id key16": newTestHasher(t, AlgorithmArgon2id, config.Argon2Config{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 16}, 4),
+		"bcrypt":         newTestHasher(t, AlgorithmBcrypt, argon2Cheap, 4),
+		"bcrypt cost 5":  newTestHasher(t, AlgorithmBcrypt, argon2Cheap, 5),
+	}
+
+	tests := []struct {
+		hashedWith string
+		verifiedBy string
+		rehash     bool
+	}{
+		{"argon2id", "argon2id", false},
+		{"argon2id", "argon2id t=2", true},
+		{"argon2id", "argon2id key16", true},
+		{"argon2id", "bcrypt", true},
+		{"bcrypt", "bcrypt", false},
+		{"bcrypt", "bcrypt cost 5", true},
+		{"bcrypt", "argon2id", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hashedWith+" verified by "+tt.verifiedBy, func(t *testing.T) {
+			encoded, err := hashers[tt.hashedWith].Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+			verifier := hashers[tt.verifiedBy]
+
+			match, rehash, err := verifier.Verify("correct horse", encoded)
+			if err != nil || !match || rehash != tt.rehash {
+				t.Errorf("right password: match %v, rehash %v, err %v; want match, rehash %v", match, rehash, err, tt.rehash)
+			}
+
+			// A wrong password never asks for a rehash
+			match, rehash, err = verifier.Verify("wrong horse", encoded)
+			if err != nil || match || rehash {
+				t.Errorf("wrong password: match %v, rehash %v, err %v", match, rehash, err)
+			}
+		})
+	}
+}
+
+func TestHashFormat(t *testing.T) {
+	h := newTestHasher(t, AlgorithmArgon2id, argon2Cheap, 4)
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("hash %q is not in PHC format", encoded)
+	}
+
+	again, _ := h.Hash("correct horse")
+	if again == encoded {
+		t.Error("two hashes of the same password share a salt")
+	}
+}
+
+func TestVerifyStoredValues(t *testing.T) {
+	h := newTestHasher(t, AlgorithmArgon2id, argon2Cheap, 4)
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"forced reset", ResetRequired, false},
+		{"truncated argon2id", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", true},
+		{"unknown argon2 version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5", true},
+		{"zero iterations", "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5", true},
+		{"not a hash", "hunter2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := h.Verify("hunter2", tt.encoded)
+			if match || rehash || (err != nil) != tt.wantErr {
+				t.Errorf("match %v, rehash %v, err %v; want no match, error %v", match, rehash, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBcryptRejectsLongPasswords(t *testing.T) {
+	h := newTestHasher(t, AlgorithmBcrypt, argon2Cheap, 4)
+	if _, err := h.Hash(strings.Repeat("a", 73)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("err %v, want ErrTooLong", err)
+	}
+}
+
+func TestNewHasherUnknownAlgorithm(t *testing.T) {
+	if _, err := NewHasher(config.PasswordHashConfig{Algorithm: "md5"}); err == nil {
+		t.Error("accepted md5")
+	}
+}
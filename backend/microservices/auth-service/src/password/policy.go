@@ -0,0 +1,169 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nbutton23/zxcvbn-go"
+
+	"auth-service/src/config"
+)
+
+// Violation codes the frontend can map to its own messages
+const (
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeBannedWord    = "banned_word"
+	CodeContainsEmail = "contains_email"
+	CodeTooWeak       = "too_weak"
+	CodeBreached      = "breached"
+)
+
+// minEmailPartLength keeps short local parts like "jo" from banning half
+// the dictionary
+const minEmailPartLength = 3
+
+// Violation is one rule a password breaks
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy decides whether a new password is acceptable. It is safe for
+// concurrent use.
+type Policy struct {
+	minLength   int
+	maxLength   int
+	minStrength int
+	banned      []string
+	breached    corpus // nil when the breach check is off
+}
+
+// NewPolicy builds the policy from the configuration, loading the banned
+// words file and opening the breach corpus
+func NewPolicy(cfg config.PasswordPolicyConfig) (*Policy, error) {
+	p := &Policy{
+		minLength:   int(cfg.MinLength),
+		maxLength:   int(cfg.MaxLength),
+		minStrength: int(cfg.MinStrength),
+	}
+
+	words := append([]string(nil), cfg.BannedWords...)
+	if cfg.BannedWordsFile != "" {
+		fromFile, err := readWords(cfg.BannedWordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("read banned words: %v", err)
+		}
+		words = append(words, fromFile...)
+	}
+	for _, word := range words {
+		if word = normalize(strings.TrimSpace(word)); word != "" {
+			p.banned = append(p.banned, word)
+		}
+	}
+
+	if cfg.BreachedPasswords != "" {
+		c, err := openCorpus(cfg.BreachedPasswords)
+		if err != nil {
+			return nil, fmt.Errorf("open breached password corpus: %v", err)
+		}
+		p.breached = c
+	}
+	return p, nil
+}
+
+// Check returns every rule the password breaks, or nil when it is acceptable.
+// email is the address of the account the password is for.
+func (p *Policy) Check(password, email string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.minLength),
+		})
+	}
+	if length > p.maxLength {
+		// The remaining checks get expensive on very long input
+		return append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters long", p.maxLength),
+		})
+	}
+
+	normalized := normalize(password)
+	for _, word := range p.banned {
+		if strings.Contains(normalized, word) {
+			violations = append(violations, Violation{
+				Code:    CodeBannedWord,
+				Message: "Password contains a word that is not allowed",
+			})
+			break
+		}
+	}
+
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if len(local) >= minEmailPartLength && strings.Contains(normalized, normalize(local)) {
+		violations = append(violations, Violation{
+			Code:    CodeContainsEmail,
+			Message: "Password must not contain your email address",
+		})
+	}
+
+	if p.minStrength > 0 {
+		inputs := append([]string{email, local}, p.banned...)
+		if zxcvbn.PasswordStrength(password, inputs).Score < p.minStrength {
+			violations = append(violations, Violation{
+				Code:    CodeTooWeak,
+				Message: "Password is too easy to guess; try a longer phrase or mix in unrelated words",
+			})
+		}
+	}
+
+	if p.breached != nil {
+		// A corpus read error should not stop people from setting passwords
+		count, err := p.breached.count(password)
+		if err != nil {
+			log.Printf("Breached password lookup failed: %v", err)
+		} else if count > 0 {
+			violations = append(violations, Violation{
+				Code:    CodeBreached,
+				Message: "Password has appeared in a data breach; choose a different one",
+			})
+		}
+	}
+
+	return violations
+}
+
+// leetReplacer undoes common letter-for-digit swaps so "P@ssw0rd" still
+// matches "password"
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s", "!", "i",
+)
+
+func normalize(s string) string {
+	return leetReplacer.Replace(strings.ToLower(s))
+}
+
+func readWords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+	return words, scanner.Err()
+}
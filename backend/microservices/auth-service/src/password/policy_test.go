@@ -0,0 +1,79 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"auth-service/src/config"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	banned := filepath.Join(t.TempDir(), "banned.txt")
+	if err := os.WriteFile(banned, []byte("acme\n\n  monitor  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := NewPolicy(config.PasswordPolicyConfig{
+		MinLength:         8,
+		MaxLength:         64,
+		MinStrength:       3,
+		BannedWords:       []string{"password"},
+		BannedWordsFile:   banned,
+		BreachedPasswords: writeSortedCorpus(t, "\n"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"strong passphrase", "correct horse battery staple", nil},
+		{"too short", "Xk9#", []string{CodeTooShort, CodeTooWeak}},
+		{"too long stops early", strings.Repeat("a", 65), []string{CodeTooLong}},
+		{"banned word", "my password is long enough", []string{CodeBannedWord}},
+		{"banned word in leetspeak", "P@ssw0rd-glacier-trombone", []string{CodeBannedWord}},
+		{"banned word from file", "Monitoring is a lovely hobby", []string{CodeBannedWord}},
+		{"contains the email", "ada.lovelace-glacier-trombone", []string{CodeContainsEmail}},
+		{"guessable", "qwertyuiop", []string{CodeTooWeak}},
+		{"breached", "breached-1234", []string{CodeTooWeak, CodeBreached}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range policy.Check(tt.password, "Ada.Lovelace@example.com") {
+				got = append(got, v.Code)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyShortEmailIsNotBanned(t *testing.T) {
+	policy, err := NewPolicy(config.PasswordPolicyConfig{MinLength: 8, MaxLength: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "jo" would otherwise rule out every password containing those letters
+	if got := policy.Check("jovial glacier trombone", "jo@example.com"); got != nil {
+		t.Errorf("Check = %v, want nil", got)
+	}
+}
+
+func TestNewPolicyMissingFiles(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	for _, cfg := range []config.PasswordPolicyConfig{
+		{BannedWordsFile: missing},
+		{BreachedPasswords: missing},
+	} {
+		if _, err := NewPolicy(cfg); err == nil {
+			t.Errorf("NewPolicy(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestMemoryLimiter returns a limiter on a fake clock and a function
+// that moves the clock forward
+func newTestMemoryLimiter() (*MemoryLimiter, func(time.Duration)) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	m.lastSweep = now
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestMemoryLimiterSweepsFullBuckets(t *testing.T) {
+	m, advance := newTestMemoryLimiter()
+	ctx := context.Background()
+
+	m.Allow(ctx, "idle", threePerThreeSeconds)
+	advance(sweepInterval / 2)
+	m.Allow(ctx, "busy", threePerThreeSeconds)
+	m.Allow(ctx, "busy", threePerThreeSeconds)
+	m.Allow(ctx, "busy", threePerThreeSeconds)
+
+	// Both refilled by now, but only a sweep interval after the last sweep
+	// are they dropped
+	advance(sweepInterval/2 - time.Second)
+	m.Allow(ctx, "other", threePerThreeSeconds)
+	if len(m.buckets) != 3 {
+		t.Fatalf("swept early: %d buckets", len(m.buckets))
+	}
+
+	advance(time.Second)
+	m.Allow(ctx, "other", threePerThreeSeconds)
+	if _, ok := m.buckets["idle"]; ok {
+		t.Error("full bucket idle was not swept")
+	}
+	if _, ok := m.buckets["busy"]; ok {
+		t.Error("full bucket busy was not swept")
+	}
+	if _, ok := m.buckets["other"]; !ok {
+		t.Error("bucket other is not full and was swept")
+	}
+}
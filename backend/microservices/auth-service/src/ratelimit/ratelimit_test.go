@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"auth-service/src/config"
+)
+
+// bucketSteps run in order against one bucket: each advances the clock by
+// wait, takes a token and expects want
+var bucketSteps = []struct {
+	name string
+	wait time.Duration
+	want Result
+}{
+	{"fresh bucket", 0, Result{Allowed: true, Remaining: 2, Reset: time.Second}},
+	{"burst", 0, Result{Allowed: true, Remaining: 1, Reset: 2 * time.Second}},
+	{"last token", 0, Result{Allowed: true, Remaining: 0, Reset: 3 * time.Second}},
+	{"empty", 0, Result{Allowed: false, Remaining: 0, RetryAfter: time.Second, Reset: 3 * time.Second}},
+	{"half refilled", 500 * time.Millisecond, Result{Allowed: false, Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: 2500 * time.Millisecond}},
+	{"one refilled", 500 * time.Millisecond, Result{Allowed: true, Remaining: 0, Reset: 3 * time.Second}},
+	{"refill caps at capacity", time.Minute, Result{Allowed: true, Remaining: 2, Reset: time.Second}},
+}
+
+// threePerThreeSeconds refills one token a second
+var threePerThreeSeconds = config.RateLimitRule{Requests: 3, Period: 3 * time.Second, Key: config.RateLimitByIP}
+
+// backend is a limiter under test with a clock the test moves forward
+type backend struct {
+	name    string
+	limiter Limiter
+	advance func(time.Duration)
+}
+
+func backends(t *testing.T) []backend {
+	memory, advanceMemory := newTestMemoryLimiter()
+	redisLimiter, _, advanceRedis := newTestRedisLimiter(t)
+	return []backend{
+		{"memory", memory, advanceMemory},
+		{"redis", redisLimiter, advanceRedis},
+	}
+}
+
+func TestBucket(t *testing.T) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			for _, step := range bucketSteps {
+				b.advance(step.wait)
+				got, err := b.limiter.Allow(context.Background(), "bucket", threePerThreeSeconds)
+				if err != nil {
+					t.Fatalf("%s: Allow: %v", step.name, err)
+				}
+				if got != step.want {
+					t.Errorf("%s: got %+v, want %+v", step.name, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBucketsAreSeparate(t *testing.T) {
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			for range threePerThreeSeconds.Requests {
+				b.limiter.Allow(ctx, "a", threePerThreeSeconds)
+			}
+			if got, _ := b.limiter.Allow(ctx, "a", threePerThreeSeconds); got.Allowed {
+				t.Fatal("bucket a should be empty")
+			}
+			if got, _ := b.limiter.Allow(ctx, "b", threePerThreeSeconds); !got.Allowed {
+				t.Fatal("bucket b should be untouched by a")
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled: true,
+		Rules: map[string]config.RateLimitRule{
+			"login": {Requests: 2, Period: time.Minute, Key: config.RateLimitByIP},
+		},
+	}
+
+	for _, b := range backends(t) {
+		t.Run(b.name, func(t *testing.T) {
+			router := newRouter(Middleware(b.limiter, cfg, "login"))
+
+			// Each token takes 30 seconds to come back
+			for i, want := range []struct{ remaining, reset string }{{"1", "30"}, {"0", "60"}} {
+				rec := serve(router, "10.0.0.1")
+				if rec.Code != http.StatusOK {
+					t.Fatalf("request %d: status %d, want 200", i+1, rec.Code)
+				}
+				wantHeaders(t, rec, map[string]string{
+					"RateLimit-Limit":     "2",
+					"RateLimit-Remaining": want.remaining,
+					"RateLimit-Reset":     want.reset,
+					"RateLimit-Policy":    "2;w=60",
+					"Retry-After":         "",
+				})
+			}
+
+			// The third request in the same minute is refused
+			rec := serve(router, "10.0.0.1")
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status %d, want 429", rec.Code)
+			}
+			wantHeaders(t, rec, map[string]string{
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "60",
+				"Retry-After":         "30",
+			})
+			var body struct {
+				ErrorCode  string `json:"error_code"`
+				RetryAfter int    `json:"retry_after"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.ErrorCode != "rate_limited" || body.RetryAfter != 30 {
+				t.Errorf("body %s", rec.Body)
+			}
+
+			// Another client has its own bucket
+			if rec := serve(router, "10.0.0.2"); rec.Code != http.StatusOK {
+				t.Errorf("other client: status %d, want 200", rec.Code)
+			}
+
+			// Half a minute later one token is back
+			b.advance(30 * time.Second)
+			if rec := serve(router, "10.0.0.1"); rec.Code != http.StatusOK {
+				t.Errorf("after refill: status %d, want 200", rec.Code)
+			}
+		})
+	}
+}
+
+func TestMiddlewarePassesThrough(t *testing.T) {
+	cfg := config.RateLimitConfig{Rules: map[string]config.RateLimitRule{"login": {Requests: 1, Period: time.Minute}}}
+
+	tests := []struct {
+		name    string
+		limiter Limiter
+		rule    string
+	}{
+		{"rate limiting off", nil, "login"},
+		{"unknown rule", NewMemoryLimiter(), "missing"},
+		{"broken limiter", failingLimiter{}, "login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(Middleware(tt.limiter, cfg, tt.rule))
+			for i := range 3 {
+				if rec := serve(router, "10.0.0.1"); rec.Code != http.StatusOK {
+					t.Fatalf("request %d: status %d, want 200", i+1, rec.Code)
+				}
+			}
+		})
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, config.RateLimitRule) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+func newRouter(limit gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/login", limit, func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func serve(router *gin.Engine, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = ip + ":12345"
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func wantHeaders(t *testing.T, rec *httptest.ResponseRecorder, want map[string]string) {
+	t.Helper()
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"auth-service/src/config"
+)
+
+// takeToken refills and takes from the bucket in one atomic step, using the
+// Redis clock so replicas agree on time. Times are in milliseconds.
+//
+// KEYS[1] bucket, ARGV[1] capacity, ARGV[2] period
+// Returns {allowed, tokens left, retry after, reset}
+var takeToken = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local rate = capacity / period
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+	tokens = capacity
+	updated = now
+end
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) / rate)
+end
+local reset = math.ceil((capacity - tokens) / rate)
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], reset + 1000)
+return {allowed, tostring(tokens), retry, reset}
+`)
+
+// RedisLimiter keeps buckets in Redis, or anything that speaks its protocol,
+// so every replica shares them
+type RedisLimiter struct {
+	client redis.UniversalClient
+}
+
+func NewRedisLimiter(client redis.UniversalClient) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+// DialRedis connects to the configured server and checks that it answers
+func DialRedis(cfg config.RedisConfig) (*RedisLimiter, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		DB:       int(cfg.DB),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("connect to redis at %s: %w", cfg.Addr, err)
+	}
+	return NewRedisLimiter(client), nil
+}
+
+func (r *RedisLimiter) Allow(ctx context.Context, key string, rule config.RateLimitRule) (Result, error) {
+	reply, err := takeToken.Run(ctx, r.client, []string{key}, rule.Requests, rule.Period.Milliseconds()).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(reply) != 4 {
+		return Result{}, fmt.Errorf("unexpected rate limit script reply %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensText, _ := reply[1].(string)
+	retry, _ := reply[2].(int64)
+	reset, _ := reply[3].(int64)
+	tokens, err := strconv.ParseFloat(tokensText, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("unexpected token count %q", tokensText)
+	}
+
+	return Result{
+		Allowed:    allowed == 1,
+		Remaining:  int(tokens),
+		RetryAfter: time.Duration(retry) * time.Millisecond,
+		Reset:      time.Duration(reset) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"auth-service/src/config"
+)
+
+// newTestRedisLimiter runs the limiter against an in-process Redis whose
+// clock only moves when the test moves it, with the returned function
+func newTestRedisLimiter(t *testing.T) (*RedisLimiter, *miniredis.Miniredis, func(time.Duration)) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		server.SetTime(now)
+		server.FastForward(d)
+	}
+	return NewRedisLimiter(client), server, advance
+}
+
+func TestRedisLimiterExpiresBuckets(t *testing.T) {
+	limiter, server, advance := newTestRedisLimiter(t)
+
+	if _, err := limiter.Allow(context.Background(), "bucket", threePerThreeSeconds); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bucket lives until it is full again, plus a second
+	if ttl := server.TTL("bucket"); ttl != 2*time.Second {
+		t.Errorf("TTL %v, want 2s", ttl)
+	}
+	advance(2 * time.Second)
+	if server.Exists("bucket") {
+		t.Error("full bucket was not expired")
+	}
+}
+
+func TestRedisLimiterUnavailable(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1, DialerRetries: 1})
+	t.Cleanup(func() { client.Close() })
+	server.Close()
+
+	limiter := NewRedisLimiter(client)
+	if _, err := limiter.Allow(context.Background(), "bucket", threePerThreeSeconds); err == nil {
+		t.Fatal("Allow succeeded without a server")
+	}
+}
+
+func TestDialRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+
+	if _, err := DialRedis(configFor(server, "wrong")); err == nil {
+		t.Error("connected with the wrong password")
+	}
+	limiter, err := DialRedis(configFor(server, "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.client.Close()
+}
+
+func configFor(server *miniredis.Miniredis, password string) config.RedisConfig {
+	return config.RedisConfig{Addr: server.Addr(), Password: password}
+}
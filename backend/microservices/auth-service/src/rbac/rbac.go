@@ -0,0 +1,162 @@
+// Package rbac defines the built-in roles and the permissions roles can be
+// granted, and seeds both into the database.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	generated "auth-service/src/db/generated"
+)
+
+// Built-in roles. The admin role cannot be renamed, deleted or have its
+// permissions edited, and the last active admin cannot lose it. The user role
+// is what new accounts get, so it cannot be renamed or deleted either.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Permissions are named "<resource>:<action>" and double as the scopes in
+// access tokens
+const (
+	UsersRead     = "users:read"
+	UsersWrite    = "users:write"
+	RolesRead     = "roles:read"
+	RolesWrite    = "roles:write"
+	IngestWrite   = "ingest:write"
+	AnalyticsRead = "analytics:read"
+)
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+// Catalog is every permission the services check
+var Catalog = []Permission{
+	{UsersRead, "View accounts, their devices and sessions"},
+	{UsersWrite, "Log users out, force password resets and unlock accounts"},
+	{RolesRead, "View roles and permissions"},
+	{RolesWrite, "Create, change and assign roles"},
+	{IngestWrite, "Send device metrics to the ingest service"},
+	{AnalyticsRead, "Read dashboards from the analytics service"},
+}
+
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// DefaultRoles are created when missing. A role is granted its permissions
+// only when it is created, so later changes through the admin API stick; the
+// admin role is the exception and always holds the whole catalog.
+var DefaultRoles = []Role{
+	{Name: RoleAdmin, Description: "Full access, including user and role management"},
+	{Name: RoleUser, Description: "Default role of every account", Permissions: []string{IngestWrite, AnalyticsRead}},
+}
+
+// IsBuiltin reports whether the role is one the service relies on
+func IsBuiltin(name string) bool {
+	return name == RoleAdmin || name == RoleUser
+}
+
+// Seed creates missing permissions and roles. It is safe to run on every
+// start, from any number of replicas.
+func Seed(ctx context.Context, pool *pgxpool.Pool) error {
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		q := generated.New(tx)
+
+		all := make([]string, 0, len(Catalog))
+		for _, p := range Catalog {
+			err := q.UpsertPermission(ctx, generated.UpsertPermissionParams{
+				Name:        p.Name,
+				Description: pgtype.Text{String: p.Description, Valid: true},
+			})
+			if err != nil {
+				return fmt.Errorf("seed permission %s: %w", p.Name, err)
+			}
+			all = append(all, p.Name)
+		}
+
+		for _, r := range DefaultRoles {
+			role, err := q.CreateRoleIfMissing(ctx, generated.CreateRoleIfMissingParams{
+				Name:        r.Name,
+				Description: pgtype.Text{String: r.Description, Valid: true},
+			})
+			created := err == nil
+			if errors.Is(err, pgx.ErrNoRows) {
+				role, err = q.FindRoleByName(ctx, r.Name)
+			}
+			if err != nil {
+				return fmt.Errorf("seed role %s: %w", r.Name, err)
+			}
+
+			grants := r.Permissions
+			if r.Name == RoleAdmin {
+				grants = all
+			} else if !created {
+				continue
+			}
+			if len(grants) == 0 {
+				continue
+			}
+			_, err = q.GrantRolePermissions(ctx, generated.GrantRolePermissionsParams{RoleID: role.ID, Names: grants})
+			if err != nil {
+				return fmt.Errorf("grant permissions to role %s: %w", r.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// CreateAdmin gives the account with the email the admin role. When there is
+// no such account it is created with a password from newHash, which is only
+// called then, and counts as verified. It reports whether it created one.
+func CreateAdmin(ctx context.Context, pool *pgxpool.Pool, email string, newHash func() (string, error)) (bool, error) {
+	created := false
+	err := pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		q := generated.New(tx)
+
+		user, err := q.FindUserByEmail(ctx, email)
+		if errors.Is(err, pgx.ErrNoRows) {
+			hash, err := newHash()
+			if err != nil {
+				return err
+			}
+			user, err = q.CreateUser(ctx, generated.CreateUserParams{
+				Email:         email,
+				PasswordHash:  pgtype.Text{String: hash, Valid: true},
+				MfaEnabled:    pgtype.Bool{Bool: false, Valid: true},
+				EmailVerified: true,
+			})
+			if err != nil {
+				return fmt.Errorf("create user: %w", err)
+			}
+			created = true
+		} else if err != nil {
+			return fmt.Errorf("find user: %w", err)
+		}
+		if user.DeletedAt.Valid {
+			return fmt.Errorf("the account for %s has been deleted", email)
+		}
+
+		for _, name := range []string{RoleUser, RoleAdmin} {
+			role, err := q.FindRoleByName(ctx, name)
+			if err != nil {
+				return fmt.Errorf("find role %s: %w", name, err)
+			}
+			if _, err := q.CreateUserRole(ctx, generated.CreateUserRoleParams{UserID: user.ID, RoleID: role.ID}); err != nil {
+				return fmt.Errorf("assign role %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	return created, err
+}
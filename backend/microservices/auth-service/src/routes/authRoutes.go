@@ -1,20 +1,68 @@
 package routes
 
 import (
+	"auth-service/src/config"
 	auth "auth-service/src/controllers"
 	"auth-service/src/middleware"
+	"auth-service/src/ratelimit"
+	"auth-service/src/rbac"
 
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterAuthRoutes(router *gin.Engine, authController *auth.AuthController) {
+func RegisterAuthRoutes(router *gin.Engine, authController *auth.AuthController, cfg *config.Config, limiter ratelimit.Limiter) {
+	limit := func(rule string) gin.HandlerFunc {
+		return ratelimit.Middleware(limiter, cfg.RateLimit, rule)
+	}
+
 	authRoutes := router.Group("/")
 	{
-		authRoutes.POST("/register", authController.Register)
-		authRoutes.POST("/login", authController.Login)
-		authRoutes.GET("/google/login", authController.GoogleLogin)
-		authRoutes.GET("/google/callback", authController.GoogleCallback)
-		authRoutes.POST("/logout", auth.LogoutHandler)
+		authRoutes.POST("/register", limit("register"), authController.Register)
+		authRoutes.POST("/login", limit("login"), authController.Login)
+		authRoutes.POST("/login/mfa", limit("login_mfa"), authController.LoginMfa)
+		authRoutes.GET("/login/unlock", authController.UnlockAccount)
+		authRoutes.GET("/verify-email", authController.VerifyEmail)
+		authRoutes.POST("/verify-email/resend", limit("email"), authController.ResendVerificationEmail)
+		authRoutes.POST("/password/forgot", limit("email"), authController.ForgotPassword)
+		authRoutes.POST("/password/reset", limit("password_reset"), authController.ResetPassword)
+		authRoutes.POST("/password/change", middleware.AuthMiddleware(), limit("password_change"), authController.ChangePassword)
+		authRoutes.GET("/google/login", limit("google"), authController.GoogleLogin)
+		authRoutes.GET("/google/callback", limit("google"), authController.GoogleCallback)
+		authRoutes.POST("/refresh", limit("refresh"), authController.Refresh)
+		authRoutes.POST("/logout", authController.Logout)
+		authRoutes.POST("/logout/all", middleware.AuthMiddleware(), authController.LogoutAll)
 		authRoutes.GET("/me", middleware.AuthMiddleware(), authController.GetMe)
+		authRoutes.GET("/me/export", middleware.AuthMiddleware(), authController.ExportMe)
+		authRoutes.DELETE("/me", middleware.AuthMiddleware(), authController.DeleteMe)
+		authRoutes.GET("/sessions", middleware.AuthMiddleware(), authController.ListSessions)
+		authRoutes.DELETE("/sessions/:id", middleware.AuthMiddleware(), authController.RevokeSession)
+		authRoutes.POST("/mfa/totp/enroll", middleware.AuthMiddleware(), middleware.RequireVerifiedEmail(), authController.EnrollTotp)
+		authRoutes.POST("/mfa/totp/confirm", middleware.AuthMiddleware(), middleware.RequireVerifiedEmail(), authController.ConfirmTotp)
+		authRoutes.POST("/mfa/disable", middleware.AuthMiddleware(), authController.DisableMfa)
+		authRoutes.POST("/mfa/recovery-codes", middleware.AuthMiddleware(), middleware.RequireVerifiedEmail(), authController.RegenerateRecoveryCodes)
+		authRoutes.POST("/webauthn/register/begin", middleware.AuthMiddleware(), middleware.RequireVerifiedEmail(), authController.BeginPasskeyRegistration)
+		authRoutes.POST("/webauthn/register/finish", middleware.AuthMiddleware(), middleware.RequireVerifiedEmail(), authController.FinishPasskeyRegistration)
+		authRoutes.POST("/webauthn/login/begin", limit("webauthn_login"), authController.BeginPasskeyLogin)
+		authRoutes.POST("/webauthn/login/finish", limit("webauthn_login"), authController.FinishPasskeyLogin)
+		authRoutes.GET("/webauthn/credentials", middleware.AuthMiddleware(), authController.ListPasskeys)
+		authRoutes.DELETE("/webauthn/credentials/:id", middleware.AuthMiddleware(), authController.DeletePasskey)
+		authRoutes.GET("/.well-known/jwks.json", auth.JWKSHandler)
+		authRoutes.POST("/introspect", middleware.ServiceAuth(cfg.Security.IntrospectionSecret), authController.Introspect)
+	}
+
+	adminRoutes := router.Group("/admin", middleware.AuthMiddleware(), middleware.RequireVerifiedEmail())
+	{
+		adminRoutes.GET("/permissions", middleware.RequirePermission(rbac.RolesRead), authController.ListPermissions)
+		adminRoutes.GET("/roles", middleware.RequirePermission(rbac.RolesRead), authController.ListRoles)
+		adminRoutes.POST("/roles", middleware.RequirePermission(rbac.RolesWrite), authController.CreateRole)
+		adminRoutes.PATCH("/roles/:id", middleware.RequirePermission(rbac.RolesWrite), authController.UpdateRole)
+		adminRoutes.DELETE("/roles/:id", middleware.RequirePermission(rbac.RolesWrite), authController.DeleteRole)
+		adminRoutes.POST("/users/:id/roles", middleware.RequirePermission(rbac.RolesWrite), authController.AssignRole)
+		adminRoutes.DELETE("/users/:id/roles/:role", middleware.RequirePermission(rbac.RolesWrite), authController.UnassignRole)
+		adminRoutes.GET("/users", middleware.RequirePermission(rbac.UsersRead), authController.ListUsers)
+		adminRoutes.GET("/users/:id", middleware.RequirePermission(rbac.UsersRead), authController.GetUser)
+		adminRoutes.POST("/users/:id/logout", middleware.RequirePermission(rbac.UsersWrite), authController.ForceLogout)
+		adminRoutes.POST("/users/:id/password-reset", middleware.RequirePermission(rbac.UsersWrite), authController.ForcePasswordReset)
+		adminRoutes.POST("/users/:id/unlock", middleware.RequirePermission(rbac.UsersWrite), authController.UnlockUser)
 	}
 }
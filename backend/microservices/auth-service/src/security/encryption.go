@@ -0,0 +1,66 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// DevEncryptionKey is used when no secret encryption key is configured
+const DevEncryptionKey = "dev-encryption-key-change-me-in-production"
+
+var secretCipher cipher.AEAD
+
+// InitSecretEncryption loads the AES-256 key that protects secrets the
+// service has to read back later, such as TOTP seeds. The key is given as
+// standard base64 of 32 random bytes (e.g. `openssl rand -base64 32`).
+func InitSecretEncryption(key string) error {
+	var raw []byte
+	if key == "" {
+		// Fallback for local dev — NEVER use this in production!
+		sum := sha256.Sum256([]byte(DevEncryptionKey))
+		raw = sum[:]
+		log.Println("[InitSecretEncryption] No encryption key configured, using the development key")
+	} else {
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return fmt.Errorf("encryption key is not valid base64: %v", err)
+		}
+		if len(decoded) != 32 {
+			return fmt.Errorf("encryption key must be 32 bytes, got %d", len(decoded))
+		}
+		raw = decoded
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return err
+	}
+	secretCipher, err = cipher.NewGCM(block)
+	return err
+}
+
+// EncryptSecret seals plaintext with AES-GCM. The associated data (e.g. the
+// owning user's ID) is authenticated but not stored, so a ciphertext copied
+// onto another row fails to decrypt.
+func EncryptSecret(plaintext, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, secretCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return secretCipher.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// DecryptSecret opens a value produced by EncryptSecret
+func DecryptSecret(ciphertext, associatedData []byte) ([]byte, error) {
+	size := secretCipher.NonceSize()
+	if len(ciphertext) < size {
+		return nil, errors.New("ciphertext too short")
+	}
+	return secretCipher.Open(nil, ciphertext[:size], ciphertext[size:], associatedData)
+}
@@ -0,0 +1,34 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+)
+
+// DevTokenHashKey is used when no token hash key is configured
+const DevTokenHashKey = "dev-token-hash-key-change-me-in-production"
+
+var tokenHashKey []byte
+
+// InitTokenHashing loads the key used to hash bearer secrets (refresh tokens
+// and the like) before they are stored. Changing the key invalidates every
+// stored hash, so it must be the same on all replicas and stable over time.
+func InitTokenHashing(key string) {
+	tokenHashKey = []byte(key)
+	if len(tokenHashKey) == 0 {
+		// Fallback for local dev — NEVER use this in production!
+		tokenHashKey = []byte(DevTokenHashKey)
+		log.Println("[InitTokenHashing] No token hash key configured, using the development key")
+	}
+}
+
+// HashToken returns the hex HMAC-SHA256 of a token. The database only ever
+// sees this value, so a leaked table or backup cannot be replayed without
+// also knowing the key.
+func HashToken(token string) string {
+	mac := hmac.New(sha256.New, tokenHashKey)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -1,78 +1,347 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"errors"
-	"os"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
-)
 
-// Load secret from environment (recommended)
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+	"auth-service/src/config"
+)
 
 const (
 	AccessTokenDuration  = 15 * time.Minute
 	RefreshTokenDuration = 7 * 24 * time.Hour
+
+	// KeyRetention keeps a retired key in the JWKS until the longest-lived
+	// token it could have signed has expired.
+	KeyRetention = RefreshTokenDuration
+
+	keyReloadInterval = time.Minute
+
+	Issuer = "auth-service"
+
+	// Audiences of the services that accept our tokens
+	AudienceAuth      = "auth-service"
+	AudienceIngest    = "ingest-service"
+	AudienceAnalytics = "analytics-service"
+
+	// TokenTypeEmailVerification marks the token mailed to confirm an address
+	TokenTypeEmailVerification = "email_verification"
+
+	// TokenTypeAccountUnlock marks the token mailed to lift a login lockout
+	TokenTypeAccountUnlock = "account_unlock"
 )
 
+var (
+	keyRing *KeyRing
+
+	// legacySecret verifies HS256 tokens issued before the switch to RS256.
+	// It is only set when JWT_SECRET is configured and never signs anything.
+	legacySecret []byte
+
+	// legacyCutover is when RS256 signing went live; only HS256 tokens
+	// issued before it can be genuine
+	legacyCutover time.Time
+
+	// accessAudiences lists every service an access token is meant for.
+	// Refresh tokens are only ever meant for the auth service itself.
+	accessAudiences = []string{AudienceAuth, AudienceIngest, AudienceAnalytics}
+
+	// legacyClaimsUntil ends the migration window for tokens that carry the
+	// user in a custom user_id claim and have no audience. It is a fixed
+	// point in time from the configuration so restarts do not extend it;
+	// unset, no such token is accepted.
+	legacyClaimsUntil time.Time
+
+	// maxAuthzClaimBytes caps the roles and scope claims together
+	maxAuthzClaimBytes = 2048
+)
+
+// Claims uses the registered claims for identity: sub is the user ID, aud the
+// services the token is meant for and jti a unique token ID.
 type Claims struct {
-	UserID pgtype.UUID `json:"user_id"`
-	Email  string      `json:"email"`
-	Type   string      `json:"type"` // "access" or "refresh"
+	UserID    pgtype.UUID `json:"-"` // parsed from sub
+	Email     string      `json:"email"`
+	Type      string      `json:"type"` // "access", "refresh", "email_verification" or "account_unlock"
+	SessionID pgtype.UUID `json:"sid"`  // sessions row the token belongs to
+
+	// Restricted access tokens belong to users who have not verified their
+	// email address yet; only the auth service accepts them.
+	Restricted bool `json:"restricted,omitempty"`
+
+	// Roles and Scope are what the user was allowed when the token was
+	// issued, so role changes show up at the next refresh. Scope is a
+	// space-separated list as in RFC 9068, e.g. "ingest:write analytics:read".
+	Roles []string `json:"roles,omitempty"`
+	Scope string   `json:"scope,omitempty"`
+
+	// LegacyUserID is only present on tokens issued before sub was used
+	LegacyUserID pgtype.UUID `json:"user_id,omitzero"`
+
 	jwt.RegisteredClaims
 }
 
-func init() {
-	if len(jwtSecret) == 0 {
-		// Fallback for local dev — NEVER use this in production!
-		jwtSecret = []byte("dev-secret-change-me-in-production")
+// InitKeys loads the signing keys from the configured key directory and keeps
+// them in sync with it. Without a key directory an ephemeral key is generated,
+// which is only suitable for local development: tokens do not survive a restart.
+func InitKeys(cfg config.JWTConfig) error {
+	if cfg.LegacySecret != "" {
+		legacySecret = []byte(cfg.LegacySecret)
+		legacyCutover = cfg.LegacyCutover
+		log.Println("[InitKeys] Accepting legacy HS256 tokens signed with the legacy secret")
+	}
+
+	if len(cfg.AccessAudiences) > 0 {
+		accessAudiences = cfg.AccessAudiences
+	}
+
+	legacyClaimsUntil = cfg.LegacyClaimsUntil
+
+	if cfg.MaxAuthzClaimBytes != 0 {
+		if cfg.MaxAuthzClaimBytes < config.MinAuthzClaimBytes {
+			return fmt.Errorf("max authz claim bytes must be at least %d", config.MinAuthzClaimBytes)
+		}
+		maxAuthzClaimBytes = int(cfg.MaxAuthzClaimBytes)
+	}
+
+	dir := cfg.KeysDir
+	if dir == "" {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return fmt.Errorf("unable to generate ephemeral signing key: %v", err)
+		}
+		keyRing = NewKeyRing([]*SigningKey{{
+			ID:          "ephemeral-" + time.Now().UTC().Format("20060102T150405Z"),
+			PrivateKey:  privateKey,
+			ActivatesAt: time.Now(),
+		}}, KeyRetention)
+		log.Println("[InitKeys] No key directory configured, using an ephemeral signing key — NEVER use this in production!")
+		return nil
+	}
+
+	keys, err := LoadKeyDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to load signing keys: %v", err)
+	}
+	keyRing = NewKeyRing(keys, KeyRetention)
+	if _, err := keyRing.Active(time.Now()); err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(keyReloadInterval) {
+			keys, err := LoadKeyDir(dir)
+			if err != nil {
+				log.Printf("[InitKeys] Failed to reload signing keys, keeping current set: %v", err)
+				continue
+			}
+			keyRing.Replace(keys)
+		}
+	}()
+
+	log.Printf("[InitKeys] Loaded %d signing key(s) from %s", len(keys), dir)
+	return nil
+}
+
+// JWKS returns the public keys verifiers need to check our tokens
+func JWKS() map[string][]JWK {
+	return keyRing.JWKS(time.Now())
+}
+
+// Authorization is what an access token lets its holder do
+type Authorization struct {
+	Roles  []string
+	Scopes []string
+}
+
+// GenerateAccessToken creates a short-lived access token carrying the user's
+// roles and scopes, as many as fit in the configured size
+func GenerateAccessToken(userID pgtype.UUID, email string, sessionID pgtype.UUID, authz Authorization) (string, error) {
+	claims := newClaims(userID, email, sessionID, "access", accessAudiences, AccessTokenDuration)
+	var dropped int
+	claims.Roles, claims.Scope, dropped = fitAuthorization(authz, maxAuthzClaimBytes)
+	if dropped > 0 {
+		log.Printf("[GenerateAccessToken] Left %d role(s) and scope(s) of user %s out of the token to stay under %d bytes",
+			dropped, userID.String(), maxAuthzClaimBytes)
 	}
+	return signClaims(claims)
 }
 
-// GenerateAccessToken creates a short-lived access token
-func GenerateAccessToken(userID pgtype.UUID, email string) (string, error) {
-	return generateToken(userID, email, "access", AccessTokenDuration)
+// GenerateRestrictedAccessToken creates an access token for a user whose
+// email address is unverified. It is only issued for the auth service, so
+// other services reject it on the audience alone.
+func GenerateRestrictedAccessToken(userID pgtype.UUID, email string, sessionID pgtype.UUID) (string, error) {
+	claims := newClaims(userID, email, sessionID, "access", []string{AudienceAuth}, AccessTokenDuration)
+	claims.Restricted = true
+	return signClaims(claims)
 }
 
 // GenerateRefreshToken creates a long-lived refresh token
-func GenerateRefreshToken(userID pgtype.UUID, email string) (string, error) {
-	return generateToken(userID, email, "refresh", RefreshTokenDuration)
+func GenerateRefreshToken(userID pgtype.UUID, email string, sessionID pgtype.UUID) (string, error) {
+	return generateToken(userID, email, sessionID, "refresh", []string{AudienceAuth}, RefreshTokenDuration)
+}
+
+// GenerateEmailVerificationToken creates the token mailed to a user to prove
+// they own their address. It is bound to the address it was sent to, so it
+// stops working if the email changes.
+func GenerateEmailVerificationToken(userID pgtype.UUID, email string, duration time.Duration) (string, error) {
+	return generateToken(userID, email, pgtype.UUID{}, TokenTypeEmailVerification, []string{AudienceAuth}, duration)
+}
+
+// GenerateAccountUnlockToken creates the token mailed to a user whose
+// account was locked after too many failed logins
+func GenerateAccountUnlockToken(userID pgtype.UUID, email string, duration time.Duration) (string, error) {
+	return generateToken(userID, email, pgtype.UUID{}, TokenTypeAccountUnlock, []string{AudienceAuth}, duration)
 }
 
-func generateToken(userID pgtype.UUID, email, tokenType string, duration time.Duration) (string, error) {
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Type:   tokenType,
+// fitAuthorization keeps scopes, then roles, in order until the next one
+// would take the encoded claims over limit, and reports how many were left
+// out. Scopes go first because they are what RequireScope checks; roles are
+// only informational for other services.
+func fitAuthorization(authz Authorization, limit int) ([]string, string, int) {
+	var roles, scopes []string
+	used := 0
+	for _, scope := range authz.Scopes {
+		// scope plus its separator
+		if used+len(scope)+1 > limit {
+			break
+		}
+		used += len(scope) + 1
+		scopes = append(scopes, scope)
+	}
+	for _, role := range authz.Roles {
+		// "role", in a JSON array
+		if used+len(role)+3 > limit {
+			break
+		}
+		used += len(role) + 3
+		roles = append(roles, role)
+	}
+	dropped := len(authz.Roles) - len(roles) + len(authz.Scopes) - len(scopes)
+	return roles, strings.Join(scopes, " "), dropped
+}
+
+// Scopes splits the scope claim
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func generateToken(userID pgtype.UUID, email string, sessionID pgtype.UUID, tokenType string, audience []string, duration time.Duration) (string, error) {
+	return signClaims(newClaims(userID, email, sessionID, tokenType, audience, duration))
+}
+
+func newClaims(userID pgtype.UUID, email string, sessionID pgtype.UUID, tokenType string, audience []string, duration time.Duration) *Claims {
+	now := time.Now()
+	return &Claims{
+		Email:     email,
+		Type:      tokenType,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "auth-service",
+			Subject:   userID.String(),
+			Audience:  audience,
+			ID:        uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    Issuer,
 		},
 	}
+}
+
+func signClaims(claims *Claims) (string, error) {
+	key, err := keyRing.Active(time.Now())
+	if err != nil {
+		return "", err
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
 }
 
-// ValidateToken parses and validates a JWT token
-func ValidateToken(tokenString string) (*Claims, error) {
+// ValidateToken parses a JWT and checks that it was issued for the given
+// audience, so a token meant for another service is rejected.
+func ValidateToken(tokenString, audience string) (*Claims, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(claims.Audience) == 0 && claims.LegacyUserID.Valid {
+		// Legacy tokens predate audiences and were valid everywhere
+		return claims, nil
+	}
+	if !slices.Contains(claims.Audience, audience) {
+		return nil, fmt.Errorf("token is not intended for %s", audience)
+	}
+	return claims, nil
+}
+
+// isLegacyToken reports whether claims look like an access or refresh token
+// issued before the switch to RS256: the user in user_id rather than sub, no
+// audience, roles or scope, issued before the cutover and presented while the
+// migration window is open. Other services hold the legacy secret too, so
+// anything else it signs may be forged.
+func isLegacyToken(claims *Claims, now time.Time) bool {
+	return (claims.Type == "access" || claims.Type == "refresh") &&
+		claims.Subject == "" && claims.LegacyUserID.Valid &&
+		len(claims.Audience) == 0 && len(claims.Roles) == 0 && claims.Scope == "" && !claims.Restricted &&
+		claims.IssuedAt != nil && claims.IssuedAt.Before(legacyCutover) &&
+		now.Before(legacyClaimsUntil)
+}
+
+// ParseToken verifies signature, expiry, not-before and issuer without
+// looking at the audience. Callers that act on the token should use
+// ValidateToken instead.
+func ParseToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA:
+			kid, _ := token.Header["kid"].(string)
+			return keyRing.PublicKey(kid, time.Now())
+		case *jwt.SigningMethodHMAC:
+			if len(legacySecret) == 0 {
+				return nil, errors.New("legacy HS256 tokens are not accepted")
+			}
+			return legacySecret, nil
+		default:
 			return nil, errors.New("unexpected signing method")
 		}
-		return jwtSecret, nil
-	})
+	}, jwt.WithValidMethods([]string{"RS256", "HS256"}), jwt.WithIssuer(Issuer))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if _, hmac := token.Method.(*jwt.SigningMethodHMAC); hmac && !isLegacyToken(claims, time.Now()) {
+		return nil, errors.New("HS256 is only accepted for legacy tokens")
+	}
+
+	if claims.Subject != "" {
+		if err := claims.UserID.Scan(claims.Subject); err != nil {
+			return nil, fmt.Errorf("invalid sub claim: %v", err)
+		}
 		return claims, nil
 	}
 
-	return nil, errors.New("invalid token")
+	// Tokens from before the switch to registered claims
+	if !claims.LegacyUserID.Valid || time.Now().After(legacyClaimsUntil) {
+		return nil, errors.New("token has no subject")
+	}
+	claims.UserID = claims.LegacyUserID
+	claims.Audience = nil
+	return claims, nil
 }
@@ -0,0 +1,220 @@
+package jwt
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const testLegacySecret = "dev-secret-change-me-in-production"
+
+// useTestKeys signs with testKey, cuts over to RS256 now and accepts legacy
+// tokens until legacyUntil, restoring the package state when the test ends
+func useTestKeys(t *testing.T, secret string, legacyUntil time.Time) {
+	t.Helper()
+	ring, oldSecret, oldCutover, oldUntil := keyRing, legacySecret, legacyCutover, legacyClaimsUntil
+	t.Cleanup(func() {
+		keyRing, legacySecret, legacyCutover, legacyClaimsUntil = ring, oldSecret, oldCutover, oldUntil
+	})
+
+	keyRing = NewKeyRing([]*SigningKey{{ID: "test", PrivateKey: testKey, ActivatesAt: time.Now().Add(-time.Hour)}}, KeyRetention)
+	legacySecret = []byte(secret)
+	legacyCutover = time.Now()
+	legacyClaimsUntil = legacyUntil
+}
+
+// legacyToken is shaped like the tokens issued before the switch to RS256:
+// the user in a user_id claim, no sub, no audience. extra adds or replaces
+// claims, and removes those it maps to nil.
+func legacyToken(t *testing.T, method jwt.SigningMethod, key any, userID pgtype.UUID, extra jwt.MapClaims) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"user_id": userID.String(),
+		"email":   "ada@example.com",
+		"type":    "access",
+		"exp":     time.Now().Add(AccessTokenDuration).Unix(),
+		"iat":     time.Now().Add(-time.Minute).Unix(),
+		"iss":     Issuer,
+	}
+	for name, value := range extra {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestLegacyTokens(t *testing.T) {
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+	hs256 := legacyToken(t, jwt.SigningMethodHS256, []byte(testLegacySecret), userID, nil)
+	rs256 := legacyToken(t, jwt.SigningMethodRS256, testKey, userID, nil)
+	forged := legacyToken(t, jwt.SigningMethodHS256, []byte("guessed"), userID, nil)
+
+	inWindow := time.Now().Add(time.Hour)
+	tests := []struct {
+		name        string
+		token       string
+		secret      string
+		legacyUntil time.Time
+		valid       bool
+	}{
+		{"HS256 in the window", hs256, testLegacySecret, inWindow, true},
+		{"RS256 in the window", rs256, "", inWindow, true},
+		{"HS256 without a legacy secret", hs256, "", inWindow, false},
+		{"HS256 with another secret", forged, testLegacySecret, inWindow, false},
+		{"HS256 after the window", hs256, testLegacySecret, time.Now().Add(-time.Second), false},
+		{"RS256 after the window", rs256, "", time.Now().Add(-time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestKeys(t, tt.secret, tt.legacyUntil)
+
+			// Legacy tokens predate audiences, so every service takes them
+			for _, audience := range []string{AudienceAuth, AudienceIngest} {
+				claims, err := ValidateToken(tt.token, audience)
+				if (err == nil) != tt.valid {
+					t.Fatalf("%s: err %v, want valid %v", audience, err, tt.valid)
+				}
+				if tt.valid && claims.UserID != userID {
+					t.Errorf("%s: user %v, want %v", audience, claims.UserID, userID)
+				}
+			}
+		})
+	}
+}
+
+func TestLegacySecretOnlySignsLegacyTokens(t *testing.T) {
+	useTestKeys(t, testLegacySecret, time.Now().Add(time.Hour))
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	// Every service that shares the legacy secret can sign these, so only
+	// the exact shape the auth service used to issue is let through
+	tests := []struct {
+		name  string
+		extra jwt.MapClaims
+		valid bool
+	}{
+		{"legacy access token", nil, true},
+		{"legacy refresh token", jwt.MapClaims{"type": "refresh"}, true},
+		{"with a subject", jwt.MapClaims{"sub": userID.String()}, false},
+		{"subject instead of user_id", jwt.MapClaims{"sub": userID.String(), "user_id": nil}, false},
+		{"with an audience", jwt.MapClaims{"aud": []string{AudienceAuth}}, false},
+		{"with roles", jwt.MapClaims{"roles": []string{"admin"}}, false},
+		{"with a scope", jwt.MapClaims{"scope": "users:write"}, false},
+		{"issued after the cutover", jwt.MapClaims{"iat": time.Now().Add(time.Minute).Unix()}, false},
+		{"without issue time", jwt.MapClaims{"iat": nil}, false},
+		{"unlock token", jwt.MapClaims{"type": TokenTypeAccountUnlock}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := legacyToken(t, jwt.SigningMethodHS256, []byte(testLegacySecret), userID, tt.extra)
+			claims, err := ParseToken(token)
+			if (err == nil) != tt.valid {
+				t.Fatalf("err %v, want valid %v", err, tt.valid)
+			}
+			if tt.valid && (claims.UserID != userID || claims.Roles != nil || claims.Scope != "") {
+				t.Errorf("claims %+v, want the legacy user and no authorization", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenChecksAudience(t *testing.T) {
+	useTestKeys(t, testLegacySecret, time.Now().Add(time.Hour))
+	userID := pgtype.UUID{Bytes: uuid.New(), Valid: true}
+
+	access, err := GenerateAccessToken(userID, "ada@example.com", pgtype.UUID{}, Authorization{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted, err := GenerateRestrictedAccessToken(userID, "ada@example.com", pgtype.UUID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := GenerateRefreshToken(userID, "ada@example.com", pgtype.UUID{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		valid    bool
+	}{
+		{"access token at the auth service", access, AudienceAuth, true},
+		{"access token at another service", access, AudienceIngest, true},
+		{"access token at an unknown service", access, "billing-service", false},
+		{"restricted token at the auth service", restricted, AudienceAuth, true},
+		{"restricted token at another service", restricted, AudienceIngest, false},
+		{"refresh token at another service", refresh, AudienceAnalytics, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateToken(tt.token, tt.audience)
+			if (err == nil) != tt.valid {
+				t.Fatalf("err %v, want valid %v", err, tt.valid)
+			}
+			if tt.valid && claims.UserID != userID {
+				t.Errorf("user %v, want %v from sub", claims.UserID, userID)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsUnsignedTokens(t *testing.T) {
+	useTestKeys(t, testLegacySecret, time.Now().Add(time.Hour))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{
+		"sub": uuid.NewString(),
+		"aud": []string{AudienceAuth},
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iss": Issuer,
+	})
+	unsigned, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(unsigned, AudienceAuth); err == nil {
+		t.Error("accepted an unsigned token")
+	}
+}
+
+func TestFitAuthorizationKeepsScopesFirst(t *testing.T) {
+	authz := Authorization{
+		Roles:  []string{"admin", "analyst"},
+		Scopes: []string{"ingest:write", "analytics:read"},
+	}
+	tests := []struct {
+		name    string
+		limit   int
+		roles   []string
+		scope   string
+		dropped int
+	}{
+		{"everything fits", 2048, []string{"admin", "analyst"}, "ingest:write analytics:read", 0},
+		{"room for one role", 36, []string{"admin"}, "ingest:write analytics:read", 1},
+		{"room for the scopes only", 30, nil, "ingest:write analytics:read", 2},
+		{"room for one scope", 14, nil, "ingest:write", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roles, scope, dropped := fitAuthorization(authz, tt.limit)
+			if !slices.Equal(roles, tt.roles) || scope != tt.scope || dropped != tt.dropped {
+				t.Errorf("got %v, %q, %d dropped; want %v, %q, %d", roles, scope, dropped, tt.roles, tt.scope, tt.dropped)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const manifestFile = "keys.json"
+
+// SigningKey is one RSA key pair of the key ring.
+//
+// A key is published in the JWKS as soon as it is in the ring, signs tokens
+// between ActivatesAt and RetiresAt, and stays published after retirement
+// until every token it signed has expired.
+type SigningKey struct {
+	ID          string
+	PrivateKey  *rsa.PrivateKey
+	ActivatesAt time.Time
+	RetiresAt   time.Time // zero while the key has no successor
+}
+
+// KeyRing holds the signing keys currently known to the service
+type KeyRing struct {
+	mu        sync.RWMutex
+	keys      []*SigningKey
+	retention time.Duration // how long retired keys stay published
+}
+
+func NewKeyRing(keys []*SigningKey, retention time.Duration) *KeyRing {
+	kr := &KeyRing{retention: retention}
+	kr.Replace(keys)
+	return kr
+}
+
+// Replace swaps in a freshly loaded set of keys
+func (kr *KeyRing) Replace(keys []*SigningKey) {
+	sorted := append([]*SigningKey(nil), keys...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ActivatesAt.Before(sorted[j].ActivatesAt)
+	})
+
+	kr.mu.Lock()
+	kr.keys = sorted
+	kr.mu.Unlock()
+}
+
+// Active returns the key that signs new tokens at the given time
+func (kr *KeyRing) Active(now time.Time) (*SigningKey, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	var active *SigningKey
+	for _, k := range kr.keys {
+		if k.ActivatesAt.After(now) {
+			break
+		}
+		if k.RetiresAt.IsZero() || now.Before(k.RetiresAt) {
+			active = k
+		}
+	}
+	if active == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return active, nil
+}
+
+// Published returns every key verifiers should know about: upcoming keys,
+// the active key and retired keys whose tokens may still be in circulation.
+func (kr *KeyRing) Published(now time.Time) []*SigningKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	published := make([]*SigningKey, 0, len(kr.keys))
+	for _, k := range kr.keys {
+		if k.RetiresAt.IsZero() || now.Before(k.RetiresAt.Add(kr.retention)) {
+			published = append(published, k)
+		}
+	}
+	return published
+}
+
+// PublicKey looks up a published key by kid
+func (kr *KeyRing) PublicKey(kid string, now time.Time) (*rsa.PublicKey, error) {
+	for _, k := range kr.Published(now) {
+		if k.ID == kid {
+			return &k.PrivateKey.PublicKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// JWK is the public half of a signing key in RFC 7517 form
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// JWKS renders the published keys as a JSON Web Key Set
+func (kr *KeyRing) JWKS(now time.Time) map[string][]JWK {
+	keys := []JWK{}
+	for _, k := range kr.Published(now) {
+		pub := k.PrivateKey.PublicKey
+		keys = append(keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: k.ID,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	return map[string][]JWK{"keys": keys}
+}
+
+// ------------------------------------------------------------------
+// Key directory
+//
+// Keys live in a directory (e.g. a mounted Kubernetes secret) as PEM files
+// next to a keys.json manifest that records when each key activates and
+// retires. Every replica reads the same directory, so a rotation written by
+// RotateKeyDir is picked up everywhere on the next reload.
+// ------------------------------------------------------------------
+
+type manifestEntry struct {
+	Kid         string     `json:"kid"`
+	File        string     `json:"file"`
+	ActivatesAt time.Time  `json:"activates_at"`
+	RetiresAt   *time.Time `json:"retires_at,omitempty"`
+}
+
+type manifest struct {
+	Keys []manifestEntry `json:"keys"`
+}
+
+// LoadKeyDir reads every key listed in the directory's manifest
+func LoadKeyDir(dir string) ([]*SigningKey, error) {
+	m, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*SigningKey, 0, len(m.Keys))
+	for _, entry := range m.Keys {
+		raw, err := os.ReadFile(filepath.Join(dir, entry.File))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read key %s: %v", entry.Kid, err)
+		}
+
+		privateKey, err := parsePrivateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse key %s: %v", entry.Kid, err)
+		}
+
+		key := &SigningKey{
+			ID:          entry.Kid,
+			PrivateKey:  privateKey,
+			ActivatesAt: entry.ActivatesAt,
+		}
+		if entry.RetiresAt != nil {
+			key.RetiresAt = *entry.RetiresAt
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// RotateKeyDir generates the next signing key. It is published immediately
+// and activates after publishAhead, at which point the current key retires.
+// Keys retired for longer than retention are removed from the directory.
+func RotateKeyDir(dir string, publishAhead, retention time.Duration) (*SigningKey, error) {
+	m, err := readManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		m = &manifest{}
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	activatesAt := now.Add(publishAhead)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate key: %v", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("unable to generate key id: %v", err)
+	}
+	kid := fmt.Sprintf("%s-%x", now.Format("20060102T150405Z"), suffix)
+	file := kid + ".pem"
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode key: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create key directory: %v", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, file), pemBytes, 0o600); err != nil {
+		return nil, fmt.Errorf("unable to write key: %v", err)
+	}
+
+	kept := make([]manifestEntry, 0, len(m.Keys)+1)
+	for _, entry := range m.Keys {
+		if entry.RetiresAt == nil {
+			// The current key (and any pending one) hands over to the new key
+			retiresAt := activatesAt
+			if entry.ActivatesAt.After(retiresAt) {
+				retiresAt = entry.ActivatesAt
+			}
+			entry.RetiresAt = &retiresAt
+		}
+
+		if now.After(entry.RetiresAt.Add(retention)) {
+			os.Remove(filepath.Join(dir, entry.File))
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	kept = append(kept, manifestEntry{Kid: kid, File: file, ActivatesAt: activatesAt})
+	m.Keys = kept
+
+	if err := writeManifest(dir, m); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{ID: kid, PrivateKey: privateKey, ActivatesAt: activatesAt}, nil
+}
+
+func readManifest(dir string) (*manifest, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", manifestFile, err)
+	}
+	return &m, nil
+}
+
+// writeManifest replaces the manifest atomically so readers never see a partial file
+func writeManifest(dir string, m *manifest) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("unable to write manifest: %v", err)
+	}
+	return os.Rename(tmp, filepath.Join(dir, manifestFile))
+}
+
+func parsePrivateKey(raw []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("key is not an RSA private key")
+	}
+	return key, nil
+}
@@ -0,0 +1,159 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+func TestKeyRing(t *testing.T) {
+	day := 24 * time.Hour
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// old hands over to current on day 10; next is published ahead of day 20
+	ring := NewKeyRing([]*SigningKey{
+		{ID: "next", PrivateKey: testKey, ActivatesAt: base.Add(20 * day)},
+		{ID: "old", PrivateKey: testKey, ActivatesAt: base, RetiresAt: base.Add(10 * day)},
+		{ID: "current", PrivateKey: testKey, ActivatesAt: base.Add(10 * day), RetiresAt: base.Add(20 * day)},
+	}, 7*day)
+
+	tests := []struct {
+		name      string
+		at        time.Time
+		active    string
+		published []string
+	}{
+		{"before any key", base.Add(-time.Second), "", []string{"old", "current", "next"}},
+		{"first key", base.Add(day), "old", []string{"old", "current", "next"}},
+		{"handover", base.Add(10 * day), "current", []string{"old", "current", "next"}},
+		{"retired key still verifies", base.Add(17*day - time.Second), "current", []string{"old", "current", "next"}},
+		{"retention over", base.Add(17 * day), "current", []string{"current", "next"}},
+		{"next key", base.Add(20 * day), "next", []string{"current", "next"}},
+		{"only the newest left", base.Add(27 * day), "next", []string{"next"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			active, err := ring.Active(tt.at)
+			switch {
+			case tt.active == "" && err == nil:
+				t.Errorf("active key %s, want none", active.ID)
+			case tt.active != "" && err != nil:
+				t.Errorf("Active: %v", err)
+			case tt.active != "" && active.ID != tt.active:
+				t.Errorf("active key %s, want %s", active.ID, tt.active)
+			}
+
+			var published []string
+			for _, k := range ring.Published(tt.at) {
+				published = append(published, k.ID)
+			}
+			if !slices.Equal(published, tt.published) {
+				t.Errorf("published %v, want %v", published, tt.published)
+			}
+
+			for _, kid := range []string{"old", "current", "next"} {
+				_, err := ring.PublicKey(kid, tt.at)
+				if want := slices.Contains(tt.published, kid); (err == nil) != want {
+					t.Errorf("PublicKey(%s): %v, want found %v", kid, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRotateKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	retention := 7 * 24 * time.Hour
+
+	// The first key has no predecessor to wait for
+	first, err := RotateKeyDir(dir, 0, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := RotateKeyDir(dir, time.Hour, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeyDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != first.ID || keys[1].ID != second.ID {
+		t.Fatalf("loaded %v", keys)
+	}
+	if !keys[0].RetiresAt.Equal(second.ActivatesAt) {
+		t.Errorf("first key retires at %v, want %v when the second activates", keys[0].RetiresAt, second.ActivatesAt)
+	}
+
+	ring := NewKeyRing(keys, retention)
+	now := time.Now()
+	if active, _ := ring.Active(now); active == nil || active.ID != first.ID {
+		t.Errorf("active now: %v, want %s until the second key activates", active, first.ID)
+	}
+	if active, _ := ring.Active(now.Add(2 * time.Hour)); active == nil || active.ID != second.ID {
+		t.Errorf("active in two hours: %v, want %s", active, second.ID)
+	}
+	if got := len(ring.Published(now)); got != 2 {
+		t.Errorf("%d keys published, want both", got)
+	}
+
+	// Once the first key has been retired for longer than the retention it
+	// is dropped at the next rotation, file and all
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	longAgo := now.Add(-2 * retention)
+	m.Keys[0].RetiresAt = &longAgo
+	if err := writeManifest(dir, m); err != nil {
+		t.Fatal(err)
+	}
+
+	third, err := RotateKeyDir(dir, time.Hour, retention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err = LoadKeyDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, k := range keys {
+		ids = append(ids, k.ID)
+	}
+	if !slices.Equal(ids, []string{second.ID, third.ID}) {
+		t.Errorf("keys after rotation %v, want %s and %s", ids, second.ID, third.ID)
+	}
+	if _, err := os.Stat(filepath.Join(dir, first.ID+".pem")); !os.IsNotExist(err) {
+		t.Errorf("retired key file still present: %v", err)
+	}
+}
+
+func TestLoadKeyDirRejectsMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := RotateKeyDir(dir, 0, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, m.Keys[0].File))
+
+	if _, err := LoadKeyDir(dir); err == nil {
+		t.Error("loaded a manifest whose key file is gone")
+	}
+}